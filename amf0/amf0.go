@@ -0,0 +1,517 @@
+/**
+ * The AMF0 codec, encode the go values to AMF0 and decode AMF0 to go values.
+ * @doc amf0-file-format-specification.pdf
+ */
+package amf0
+
+import (
+    "bytes"
+    "encoding/binary"
+    "fmt"
+    "io"
+    "math"
+    "reflect"
+    "sort"
+    "strings"
+    "time"
+)
+
+/*
+@doc video_file_format_spec_v10_1.pdf, page 80
+@doc amf0-file-format-specification.pdf, page 4, 2.1 Types Overview
+*/
+const (
+    AMF_DATA_TYPE_NUMBER = 0
+    AMF_DATA_TYPE_BOOLEAN = 1
+    AMF_DATA_TYPE_STRING = 2
+    AMF_DATA_TYPE_OBJECT = 3
+    AMF_DATA_TYPE_MOVIECLIP = 4 // reserved, not supported
+    AMF_DATA_TYPE_NULL = 5
+    AMF_DATA_TYPE_UNDEFINED = 6
+
+    AMF_DATA_TYPE_Reference = 7
+    AMF_DATA_TYPE_ECMA_array = 8
+    AMF_DATA_TYPE_OBJECT_END = 9
+    AMF_DATA_TYPE_STRICT_ARRAY = 10
+    AMF_DATA_TYPE_DATE = 11
+    AMF_DATA_TYPE_LONG_STRING = 12
+)
+
+/**
+ * The AMF0 types map to go values:
+ *      number          float64, encode from all int, uint and float types.
+ *      boolean         bool
+ *      string          string, encode as long string when larger than 0xffff.
+ *      long string     string
+ *      object          *Object, encode from map with string key and struct.
+ *      ECMA array      *EcmaArray
+ *      strict array    []interface{}, encode from all slice and array types.
+ *      date            time.Time
+ *      null            nil
+ *      undefined       Undefined
+ */
+
+// The undefined value of AMF0, while nil is null.
+type Undefined struct{}
+
+// The property of AMF0 object and ECMA array.
+type Property struct {
+    Name  string
+    Value interface{}
+}
+
+/**
+ * The AMF0 object, the properties are ordered as added.
+ * 2.5 Object Type, amf0-file-format-specification.pdf, page 5
+ */
+type Object struct {
+    properties []*Property
+}
+
+func NewObject() *Object {
+    return &Object{}
+}
+
+// Set the property, replace the value in place when exists, or append it.
+func (v *Object) Set(name string, value interface{}) {
+    for _, p := range v.properties {
+        if p.Name == name {
+            p.Value = value
+            return
+        }
+    }
+    v.properties = append(v.properties, &Property{Name: name, Value: value})
+}
+
+func (v *Object) Get(name string) (value interface{}, ok bool) {
+    for _, p := range v.properties {
+        if p.Name == name {
+            return p.Value, true
+        }
+    }
+    return nil, false
+}
+
+// Remove the property, return false when not exists.
+func (v *Object) Remove(name string) bool {
+    for i, p := range v.properties {
+        if p.Name == name {
+            v.properties = append(v.properties[:i], v.properties[i+1:]...)
+            return true
+        }
+    }
+    return false
+}
+
+func (v *Object) Len() int {
+    return len(v.properties)
+}
+
+func (v *Object) Properties() []*Property {
+    return v.properties
+}
+
+// Convert to go map, the nested object and ECMA array are converted too.
+func (v *Object) ToMap() map[string]interface{} {
+    m := make(map[string]interface{})
+    for _, p := range v.properties {
+        m[p.Name] = toGo(p.Value)
+    }
+    return m
+}
+
+func toGo(value interface{}) interface{} {
+    switch t := value.(type) {
+    case *Object:
+        return t.ToMap()
+    case *EcmaArray:
+        return t.ToMap()
+    case []interface{}:
+        arr := make([]interface{}, len(t))
+        for i, e := range t {
+            arr[i] = toGo(e)
+        }
+        return arr
+    }
+    return value
+}
+
+/**
+ * The AMF0 ECMA array, an associative array with a count hint, for example, the onMetaData.
+ * 2.10 ECMA Array Type, amf0-file-format-specification.pdf, page 6
+ */
+type EcmaArray struct {
+    Object
+}
+
+func NewEcmaArray() *EcmaArray {
+    return &EcmaArray{}
+}
+
+// Encode the values to AMF0 bytes in order, for example, the "onMetaData" and the ECMA array.
+func Marshal(values ...interface{}) (data []byte, err error) {
+    buf := new(bytes.Buffer)
+    if err = Encode(buf, values...); err != nil {
+        return
+    }
+    return buf.Bytes(), nil
+}
+
+// Decode all AMF0 values in data.
+func Unmarshal(data []byte) (values []interface{}, err error) {
+    r := bytes.NewReader(data)
+    for r.Len() > 0 {
+        var value interface{}
+        if value, err = Decode(r); err != nil {
+            return
+        }
+        values = append(values, value)
+    }
+    return
+}
+
+func Encode(w io.Writer, values ...interface{}) (err error) {
+    for _, value := range values {
+        if err = write(w, reflect.ValueOf(value)); err != nil {
+            return
+        }
+    }
+    return
+}
+
+func writeMarker(w io.Writer, marker uint8) error {
+    return binary.Write(w, binary.BigEndian, marker)
+}
+
+// The UTF-8 without marker, for the string and the property name.
+// 1.3.1 Strings and UTF-8, amf0-file-format-specification.pdf, page 3
+func writeUtf8(w io.Writer, data string) (err error) {
+    if len(data) > math.MaxUint16 {
+        return fmt.Errorf("amf0 utf8 too long, len=%v", len(data))
+    }
+    if err = binary.Write(w, binary.BigEndian, uint16(len(data))); err != nil {
+        return
+    }
+    _, err = io.WriteString(w, data)
+    return
+}
+
+func writeNumber(w io.Writer, data float64) (err error) {
+    if err = writeMarker(w, AMF_DATA_TYPE_NUMBER); err != nil {
+        return
+    }
+    return binary.Write(w, binary.BigEndian, data)
+}
+
+func writeString(w io.Writer, data string) (err error) {
+    if len(data) <= math.MaxUint16 {
+        if err = writeMarker(w, AMF_DATA_TYPE_STRING); err != nil {
+            return
+        }
+        return writeUtf8(w, data)
+    }
+
+    if err = writeMarker(w, AMF_DATA_TYPE_LONG_STRING); err != nil {
+        return
+    }
+    if err = binary.Write(w, binary.BigEndian, uint32(len(data))); err != nil {
+        return
+    }
+    _, err = io.WriteString(w, data)
+    return
+}
+
+// The properties of object or ECMA array, end with the empty name and object end marker.
+func writeProperties(w io.Writer, props []*Property) (err error) {
+    for _, p := range props {
+        if err = writeUtf8(w, p.Name); err != nil {
+            return
+        }
+        if err = write(w, reflect.ValueOf(p.Value)); err != nil {
+            return fmt.Errorf("amf0 write property %v failed, err is %v", p.Name, err)
+        }
+    }
+    if err = writeUtf8(w, ""); err != nil {
+        return
+    }
+    return writeMarker(w, AMF_DATA_TYPE_OBJECT_END)
+}
+
+func write(w io.Writer, value reflect.Value) (err error) {
+    if !value.IsValid() {
+        return writeMarker(w, AMF_DATA_TYPE_NULL)
+    }
+
+    // The AMF0 types.
+    switch t := value.Interface().(type) {
+    case Undefined:
+        return writeMarker(w, AMF_DATA_TYPE_UNDEFINED)
+    case *Object:
+        if t == nil {
+            return writeMarker(w, AMF_DATA_TYPE_NULL)
+        }
+        if err = writeMarker(w, AMF_DATA_TYPE_OBJECT); err != nil {
+            return
+        }
+        return writeProperties(w, t.properties)
+    case Object:
+        return write(w, reflect.ValueOf(&t))
+    case EcmaArray:
+        return write(w, reflect.ValueOf(&t))
+    case *EcmaArray:
+        if t == nil {
+            return writeMarker(w, AMF_DATA_TYPE_NULL)
+        }
+        if err = writeMarker(w, AMF_DATA_TYPE_ECMA_array); err != nil {
+            return
+        }
+        if err = binary.Write(w, binary.BigEndian, uint32(t.Len())); err != nil {
+            return
+        }
+        return writeProperties(w, t.properties)
+    case time.Time:
+        // 2.13 Date Type, the milliseconds since epoch in UTC, and the reserved time-zone.
+        if err = writeMarker(w, AMF_DATA_TYPE_DATE); err != nil {
+            return
+        }
+        if err = binary.Write(w, binary.BigEndian, float64(t.UnixNano() / int64(time.Millisecond))); err != nil {
+            return
+        }
+        return binary.Write(w, binary.BigEndian, int16(0))
+    }
+
+    // The go types.
+    switch value.Kind() {
+    case reflect.Bool:
+        if err = writeMarker(w, AMF_DATA_TYPE_BOOLEAN); err != nil {
+            return
+        }
+        var b uint8
+        if value.Bool() {
+            b = 1
+        }
+        return binary.Write(w, binary.BigEndian, b)
+    case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+        return writeNumber(w, float64(value.Int()))
+    case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+        return writeNumber(w, float64(value.Uint()))
+    case reflect.Float32, reflect.Float64:
+        return writeNumber(w, value.Float())
+    case reflect.String:
+        return writeString(w, value.String())
+    case reflect.Ptr, reflect.Interface:
+        if value.IsNil() {
+            return writeMarker(w, AMF_DATA_TYPE_NULL)
+        }
+        return write(w, value.Elem())
+    case reflect.Slice, reflect.Array:
+        if value.Kind() == reflect.Slice && value.IsNil() {
+            return writeMarker(w, AMF_DATA_TYPE_NULL)
+        }
+        // 2.12 Strict Array Type
+        if err = writeMarker(w, AMF_DATA_TYPE_STRICT_ARRAY); err != nil {
+            return
+        }
+        if err = binary.Write(w, binary.BigEndian, uint32(value.Len())); err != nil {
+            return
+        }
+        for i := 0; i < value.Len(); i++ {
+            if err = write(w, value.Index(i)); err != nil {
+                return
+            }
+        }
+        return
+    case reflect.Map:
+        if value.Type().Key().Kind() != reflect.String {
+            return fmt.Errorf("amf0 unsupported map key %v", value.Type().Key())
+        }
+        if value.IsNil() {
+            return writeMarker(w, AMF_DATA_TYPE_NULL)
+        }
+        // Sort the keys, to make the output stable.
+        var keys []string
+        for _, k := range value.MapKeys() {
+            keys = append(keys, k.String())
+        }
+        sort.Strings(keys)
+
+        obj := NewObject()
+        for _, k := range keys {
+            obj.Set(k, value.MapIndex(reflect.ValueOf(k).Convert(value.Type().Key())).Interface())
+        }
+        return write(w, reflect.ValueOf(obj))
+    case reflect.Struct:
+        return write(w, reflect.ValueOf(structToObject(value)))
+    }
+
+    return fmt.Errorf("amf0 unsupported type %v", value.Type())
+}
+
+// Convert the exported fields of struct to object, use the tag to rename or skip,
+// for example, `amf0:"videocodecid"`, `amf0:"author,omitempty"` or `amf0:"-"`.
+func structToObject(value reflect.Value) *Object {
+    obj := NewObject()
+
+    t := value.Type()
+    for i := 0; i < t.NumField(); i++ {
+        field := t.Field(i)
+        if field.PkgPath != "" {
+            continue
+        }
+
+        name, omitEmpty := field.Name, false
+        if tag := field.Tag.Get("amf0"); tag != "" {
+            opts := strings.Split(tag, ",")
+            if opts[0] == "-" {
+                continue
+            }
+            if opts[0] != "" {
+                name = opts[0]
+            }
+            for _, opt := range opts[1:] {
+                if opt == "omitempty" {
+                    omitEmpty = true
+                }
+            }
+        }
+
+        fv := value.Field(i)
+        if omitEmpty && isEmpty(fv) {
+            continue
+        }
+        obj.Set(name, fv.Interface())
+    }
+
+    return obj
+}
+
+func isEmpty(value reflect.Value) bool {
+    switch value.Kind() {
+    case reflect.Slice, reflect.Map, reflect.String, reflect.Array:
+        return value.Len() == 0
+    case reflect.Ptr, reflect.Interface:
+        return value.IsNil()
+    }
+    return reflect.DeepEqual(value.Interface(), reflect.Zero(value.Type()).Interface())
+}
+
+// Decode a AMF0 value, see the type map of codec.
+func Decode(r io.Reader) (value interface{}, err error) {
+    var marker uint8
+    if err = binary.Read(r, binary.BigEndian, &marker); err != nil {
+        return nil, fmt.Errorf("amf0 read marker failed, err is %v", err)
+    }
+
+    switch marker {
+    case AMF_DATA_TYPE_NUMBER:
+        var data float64
+        if err = binary.Read(r, binary.BigEndian, &data); err != nil {
+            return nil, fmt.Errorf("amf0 read number failed, err is %v", err)
+        }
+        return data, nil
+    case AMF_DATA_TYPE_BOOLEAN:
+        var data uint8
+        if err = binary.Read(r, binary.BigEndian, &data); err != nil {
+            return nil, fmt.Errorf("amf0 read boolean failed, err is %v", err)
+        }
+        return data != 0, nil
+    case AMF_DATA_TYPE_STRING:
+        return readUtf8(r)
+    case AMF_DATA_TYPE_LONG_STRING:
+        var size uint32
+        if err = binary.Read(r, binary.BigEndian, &size); err != nil {
+            return nil, fmt.Errorf("amf0 read long string size failed, err is %v", err)
+        }
+        return readString(r, int64(size))
+    case AMF_DATA_TYPE_OBJECT:
+        obj := NewObject()
+        if err = readProperties(r, obj); err != nil {
+            return
+        }
+        return obj, nil
+    case AMF_DATA_TYPE_ECMA_array:
+        // The count is only a hint, the properties end with object end marker.
+        var count uint32
+        if err = binary.Read(r, binary.BigEndian, &count); err != nil {
+            return nil, fmt.Errorf("amf0 read ECMA array count failed, err is %v", err)
+        }
+        arr := NewEcmaArray()
+        if err = readProperties(r, &arr.Object); err != nil {
+            return
+        }
+        return arr, nil
+    case AMF_DATA_TYPE_STRICT_ARRAY:
+        var count uint32
+        if err = binary.Read(r, binary.BigEndian, &count); err != nil {
+            return nil, fmt.Errorf("amf0 read strict array count failed, err is %v", err)
+        }
+        arr := []interface{}{}
+        for i := uint32(0); i < count; i++ {
+            var e interface{}
+            if e, err = Decode(r); err != nil {
+                return
+            }
+            arr = append(arr, e)
+        }
+        return arr, nil
+    case AMF_DATA_TYPE_DATE:
+        var ms float64
+        var tz int16
+        if err = binary.Read(r, binary.BigEndian, &ms); err != nil {
+            return nil, fmt.Errorf("amf0 read date failed, err is %v", err)
+        }
+        if err = binary.Read(r, binary.BigEndian, &tz); err != nil {
+            return nil, fmt.Errorf("amf0 read date time-zone failed, err is %v", err)
+        }
+        return time.Unix(0, int64(ms) * int64(time.Millisecond)).UTC(), nil
+    case AMF_DATA_TYPE_NULL:
+        return nil, nil
+    case AMF_DATA_TYPE_UNDEFINED:
+        return Undefined{}, nil
+    }
+
+    return nil, fmt.Errorf("amf0 unsupported marker %v", marker)
+}
+
+func readString(r io.Reader, size int64) (data string, err error) {
+    buf := new(bytes.Buffer)
+    if _, err = io.CopyN(buf, r, size); err != nil {
+        return "", fmt.Errorf("amf0 read string failed, size=%v, err is %v", size, err)
+    }
+    return buf.String(), nil
+}
+
+func readUtf8(r io.Reader) (data string, err error) {
+    var size uint16
+    if err = binary.Read(r, binary.BigEndian, &size); err != nil {
+        return "", fmt.Errorf("amf0 read utf8 size failed, err is %v", err)
+    }
+    return readString(r, int64(size))
+}
+
+func readProperties(r io.Reader, obj *Object) (err error) {
+    for {
+        var name string
+        if name, err = readUtf8(r); err != nil {
+            return
+        }
+
+        // The empty name with object end marker.
+        if name == "" {
+            var marker uint8
+            if err = binary.Read(r, binary.BigEndian, &marker); err != nil {
+                return fmt.Errorf("amf0 read object end failed, err is %v", err)
+            }
+            if marker != AMF_DATA_TYPE_OBJECT_END {
+                return fmt.Errorf("amf0 invalid object end marker %v", marker)
+            }
+            return
+        }
+
+        var value interface{}
+        if value, err = Decode(r); err != nil {
+            return fmt.Errorf("amf0 read property %v failed, err is %v", name, err)
+        }
+        obj.Set(name, value)
+    }
+}
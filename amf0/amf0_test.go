@@ -0,0 +1,190 @@
+package amf0
+
+import (
+    "bytes"
+    "reflect"
+    "strings"
+    "testing"
+    "time"
+)
+
+// Encode the value then decode it, the decoded must equal to expect.
+func roundTrip(t *testing.T, marker uint8, value, expect interface{}) {
+    data, err := Marshal(value)
+    if err != nil {
+        t.Fatalf("marshal %T failed, err is %v", value, err)
+    }
+    if data[0] != marker {
+        t.Fatalf("marshal %T, marker is %v, expect %v", value, data[0], marker)
+    }
+
+    values, err := Unmarshal(data)
+    if err != nil {
+        t.Fatalf("unmarshal %T failed, err is %v", value, err)
+    }
+    if len(values) != 1 {
+        t.Fatalf("unmarshal %T, got %v values", value, len(values))
+    }
+    if !reflect.DeepEqual(values[0], expect) {
+        t.Errorf("round trip %T, got %#v, expect %#v", value, values[0], expect)
+    }
+}
+
+func TestNumber(t *testing.T) {
+    roundTrip(t, AMF_DATA_TYPE_NUMBER, 29.97, 29.97)
+    roundTrip(t, AMF_DATA_TYPE_NUMBER, -1.5, -1.5)
+    roundTrip(t, AMF_DATA_TYPE_NUMBER, 1920, float64(1920))
+    roundTrip(t, AMF_DATA_TYPE_NUMBER, uint32(0xffffffff), float64(0xffffffff))
+    roundTrip(t, AMF_DATA_TYPE_NUMBER, int8(-7), float64(-7))
+}
+
+func TestBoolean(t *testing.T) {
+    roundTrip(t, AMF_DATA_TYPE_BOOLEAN, true, true)
+    roundTrip(t, AMF_DATA_TYPE_BOOLEAN, false, false)
+}
+
+func TestString(t *testing.T) {
+    roundTrip(t, AMF_DATA_TYPE_STRING, "", "")
+    roundTrip(t, AMF_DATA_TYPE_STRING, "onMetaData", "onMetaData")
+
+    // The max size of string, not the long string.
+    s := strings.Repeat("x", 0xffff)
+    roundTrip(t, AMF_DATA_TYPE_STRING, s, s)
+}
+
+func TestLongString(t *testing.T) {
+    s := strings.Repeat("ab", 0xffff)
+    roundTrip(t, AMF_DATA_TYPE_LONG_STRING, s, s)
+
+    data, err := Marshal(s)
+    if err != nil {
+        t.Fatalf("marshal failed, err is %v", err)
+    }
+    if len(data) != 1 + 4 + len(s) {
+        t.Errorf("long string size is %v, expect %v", len(data), 1 + 4 + len(s))
+    }
+}
+
+func TestObject(t *testing.T) {
+    obj := NewObject()
+    obj.Set("name", "chapter")
+    obj.Set("time", 1.5)
+    obj.Set("type", "navigation")
+    obj.Set("parameters", NewObject())
+    roundTrip(t, AMF_DATA_TYPE_OBJECT, obj, obj)
+
+    // The properties are ordered as added.
+    values, _ := Unmarshal(mustMarshal(t, obj))
+    var names []string
+    for _, p := range values[0].(*Object).Properties() {
+        names = append(names, p.Name)
+    }
+    if expect := []string{"name", "time", "type", "parameters"}; !reflect.DeepEqual(names, expect) {
+        t.Errorf("properties are %v, expect %v", names, expect)
+    }
+
+    // The map with string key and struct are encoded as object.
+    m := map[string]interface{}{"width": 1920, "stereo": true}
+    expect := NewObject()
+    expect.Set("stereo", true)
+    expect.Set("width", float64(1920))
+    roundTrip(t, AMF_DATA_TYPE_OBJECT, m, expect)
+
+    s := struct {
+        Width int `amf0:"width"`
+        Author string `amf0:"author,omitempty"`
+        Ignore bool `amf0:"-"`
+    }{Width: 1280}
+    expect = NewObject()
+    expect.Set("width", float64(1280))
+    roundTrip(t, AMF_DATA_TYPE_OBJECT, s, expect)
+}
+
+func TestEcmaArray(t *testing.T) {
+    arr := NewEcmaArray()
+    arr.Set("duration", 3600.5)
+    arr.Set("stereo", true)
+    arr.Set("encoder", "mp4_to_flv")
+    roundTrip(t, AMF_DATA_TYPE_ECMA_array, arr, arr)
+
+    // The count of ECMA array, after the marker.
+    data := mustMarshal(t, arr)
+    if count := uint32(data[1]) << 24 | uint32(data[2]) << 16 | uint32(data[3]) << 8 | uint32(data[4]); count != 3 {
+        t.Errorf("ECMA array count is %v, expect 3", count)
+    }
+}
+
+func TestStrictArray(t *testing.T) {
+    roundTrip(t, AMF_DATA_TYPE_STRICT_ARRAY, []float64{0, 2.5, 5}, []interface{}{float64(0), 2.5, float64(5)})
+    roundTrip(t, AMF_DATA_TYPE_STRICT_ARRAY, []interface{}{"a", true, nil}, []interface{}{"a", true, nil})
+    roundTrip(t, AMF_DATA_TYPE_STRICT_ARRAY, [2]uint32{1, 2}, []interface{}{float64(1), float64(2)})
+    roundTrip(t, AMF_DATA_TYPE_STRICT_ARRAY, []int{}, []interface{}{})
+}
+
+func TestDate(t *testing.T) {
+    d := time.Date(2016, 1, 2, 3, 4, 5, 6000000, time.UTC)
+    roundTrip(t, AMF_DATA_TYPE_DATE, d, d)
+
+    // The milliseconds and the reserved time-zone.
+    if data := mustMarshal(t, d); len(data) != 1 + 8 + 2 {
+        t.Errorf("date size is %v, expect %v", len(data), 1 + 8 + 2)
+    }
+}
+
+func TestNullAndUndefined(t *testing.T) {
+    roundTrip(t, AMF_DATA_TYPE_NULL, nil, nil)
+    roundTrip(t, AMF_DATA_TYPE_NULL, (*Object)(nil), nil)
+    roundTrip(t, AMF_DATA_TYPE_NULL, []int(nil), nil)
+    roundTrip(t, AMF_DATA_TYPE_UNDEFINED, Undefined{}, Undefined{})
+}
+
+func TestObjectEnd(t *testing.T) {
+    obj := NewObject()
+    obj.Set("a", 1)
+
+    // The properties end with the empty name and object end marker.
+    data := mustMarshal(t, obj)
+    if end := data[len(data) - 3:]; !bytes.Equal(end, []byte{0, 0, AMF_DATA_TYPE_OBJECT_END}) {
+        t.Errorf("object end is %v", end)
+    }
+
+    arr := NewEcmaArray()
+    data = mustMarshal(t, arr)
+    if !bytes.Equal(data, []byte{AMF_DATA_TYPE_ECMA_array, 0, 0, 0, 0, 0, 0, AMF_DATA_TYPE_OBJECT_END}) {
+        t.Errorf("empty ECMA array is %v", data)
+    }
+
+    // The invalid object end marker.
+    data = []byte{AMF_DATA_TYPE_OBJECT, 0, 0, AMF_DATA_TYPE_NULL}
+    if _, err := Unmarshal(data); err == nil {
+        t.Errorf("should fail for invalid object end %v", data)
+    }
+
+    // The object without end.
+    data = mustMarshal(t, obj)
+    if _, err := Unmarshal(data[:len(data) - 1]); err == nil {
+        t.Errorf("should fail for object without end")
+    }
+}
+
+func TestMultipleValues(t *testing.T) {
+    meta := NewEcmaArray()
+    meta.Set("duration", float64(10))
+
+    data := mustMarshal(t, "onMetaData", meta)
+    values, err := Unmarshal(data)
+    if err != nil {
+        t.Fatalf("unmarshal failed, err is %v", err)
+    }
+    if expect := []interface{}{"onMetaData", meta}; !reflect.DeepEqual(values, expect) {
+        t.Errorf("values are %#v, expect %#v", values, expect)
+    }
+}
+
+func mustMarshal(t *testing.T, values ...interface{}) []byte {
+    data, err := Marshal(values...)
+    if err != nil {
+        t.Fatalf("marshal failed, err is %v", err)
+    }
+    return data
+}
@@ -1,11 +1,15 @@
 package main
 
 import (
+    "bytes"
     "fmt"
     "io"
     ol "github.com/ossrs/go-oryx-lib/logger"
     "encoding/binary"
+    "io/ioutil"
+    "math"
     "reflect"
+    "strings"
 )
 
 type Box interface {
@@ -48,8 +52,9 @@ func NewMp4Box() *Mp4Box {
 }
 
 // Get the size of box, whatever small or large size.
+// For the box extends to the end of file, the large size is resolved when discovery.
 func (v *Mp4Box) sz() uint64 {
-    if v.SmallSize == SRS_MP4_USE_LARGE_SIZE {
+    if v.SmallSize == SRS_MP4_USE_LARGE_SIZE || v.SmallSize == SRS_MP4_EOF_SIZE {
         return v.LargeSize
     }
     return uint64(v.SmallSize)
@@ -99,7 +104,17 @@ func (v *Mp4Box) DecodeHeader(r io.Reader) (err error) {
     return
 }
 
+// Discovery the contained box, which never extends to the end of file.
 func (v *Mp4Box) discovery(r io.Reader) (box Box, err error) {
+    return v.doDiscovery(r, false)
+}
+
+// Discovery the top-level box of file, only the last one maybe extends to the end of file.
+func (v *Mp4Box) discoveryTopLevel(r io.Reader) (box Box, err error) {
+    return v.doDiscovery(r, true)
+}
+
+func (v *Mp4Box) doDiscovery(r io.Reader, topLevel bool) (box Box, err error) {
     v.UsedSize = 0
 
     // Discovery the size and type.
@@ -124,9 +139,22 @@ func (v *Mp4Box) discovery(r io.Reader) (box Box, err error) {
         }
     }
 
-    // Only support 31bits size.
-    if (largeSize > 0x7fffffff) {
-        err = fmt.Errorf("box overflow")
+    // The box extends to the end of file, resolve the actual size.
+    // 4.2 Object Structure, ISO_IEC_14496-12-base-format-2012.pdf
+    if smallSize == SRS_MP4_EOF_SIZE && !topLevel {
+        err = fmt.Errorf("box %v extends to eof, only allowed for top-level box", fourCCString(bt))
+        ol.E(nil, err.Error())
+        return
+    }
+    if smallSize == SRS_MP4_EOF_SIZE {
+        if largeSize, err = v.sizeToEOF(r); err != nil {
+            ol.E(nil, fmt.Sprintf("resolve eof size failed, err is %v", err))
+            return
+        }
+    }
+
+    if smallSize == SRS_MP4_USE_LARGE_SIZE && largeSize < v.UsedSize {
+        err = fmt.Errorf("box overflow, large size=%v", largeSize)
         ol.E(nil, err.Error())
         return
     }
@@ -142,6 +170,14 @@ func (v *Mp4Box) discovery(r io.Reader) (box Box, err error) {
         box = &Mp4TrackBox{}
     case SrsMp4BoxTypeTKHD:
         box = NewMp4TrackHeaderBox()
+    case SrsMp4BoxTypeTREF:
+        box = &Mp4TrackReferenceBox{}
+    case SrsMp4BoxTypeCHAP:
+        box = &Mp4TrackReferenceTypeBox{}
+    case SrsMp4BoxTypeEDTS:
+        box = &Mp4EditBox{}
+    case SrsMp4BoxTypeELST:
+        box = NewMp4EditListBox()
     case SrsMp4BoxTypeMDIA:
         box = &Mp4MediaBox{}
     case SrsMp4BoxTypeMDHD:
@@ -161,10 +197,42 @@ func (v *Mp4Box) discovery(r io.Reader) (box Box, err error) {
         box = NewMp4VisualSampleEntry()
     case SrsMp4BoxTypeAVCC:
         box = &Mp4AvccBox{}
-    case SrsMp4BoxTypeMP4A:
+    case SrsMp4BoxTypeHVC1, SrsMp4BoxTypeHEV1:
+        box = NewMp4VisualSampleEntry()
+    case SrsMp4BoxTypeHVCC:
+        box = &Mp4HvccBox{}
+    case SrsMp4BoxTypeAV01:
+        box = NewMp4VisualSampleEntry()
+    case SrsMp4BoxTypeAV1C:
+        box = &Mp4Av1cBox{}
+    case SrsMp4BoxTypeVP09:
+        box = NewMp4VisualSampleEntry()
+    case SrsMp4BoxTypeVPCC:
+        box = &Mp4VpccBox{}
+    case SrsMp4BoxTypeMP4A, SrsMp4BoxTypeOPUS, SrsMp4BoxTypeFLAC, SrsMp4BoxTypeAC3, SrsMp4BoxTypeEC3:
+        box = &Mp4AudioSampleEntry{}
+    case SrsMp4BoxTypeSOWT, SrsMp4BoxTypeTWOS, SrsMp4BoxTypeLPCM, SrsMp4BoxTypeIPCM:
         box = &Mp4AudioSampleEntry{}
+    case SrsMp4BoxTypeALAW, SrsMp4BoxTypeULAW:
+        box = &Mp4AudioSampleEntry{}
+    case SrsMp4BoxTypePCMC:
+        box = &Mp4PcmConfigBox{}
+    case SrsMp4BoxTypeDOPS:
+        box = &Mp4OpusSpecificBox{}
+    case SrsMp4BoxTypeDFLA:
+        box = &Mp4FlacSpecificBox{}
+    case SrsMp4BoxTypeDAC3:
+        box = &Mp4AC3SpecificBox{}
+    case SrsMp4BoxTypeDEC3:
+        box = &Mp4EC3SpecificBox{}
     case SrsMp4BoxTypeESDS:
         box = NewMp4EsdsBox()
+    case SrsMp4BoxTypeTX3G:
+        box = &Mp4TextSampleEntry{}
+    case SrsMp4BoxTypeWVTT:
+        box = &Mp4WebVTTSampleEntry{}
+    case SrsMp4BoxTypeVTTCONFIG:
+        box = &Mp4WebVTTConfigBox{}
 
     case SrsMp4BoxTypeSTSD:
         box = NewMp4SampleDescritionBox()
@@ -178,12 +246,41 @@ func (v *Mp4Box) discovery(r io.Reader) (box Box, err error) {
         box = NewMp4Sample2ChunkBox()
     case SrsMp4BoxTypeSTSZ:
         box = NewMp4SampleSizeBox()
+    case SrsMp4BoxTypeSTZ2:
+        box = NewMp4CompactSampleSizeBox()
     case SrsMp4BoxTypeSTCO:
         box = NewMp4ChunkOffsetBox()
+    case SrsMp4BoxTypeCO64:
+        box = NewMp4ChunkLargeOffsetBox()
     case SrsMp4BoxTypeUDTA:
         box = NewMp4UserDataBox()
+    case SrsMp4BoxTypeMETA:
+        box = &Mp4MetaBox{}
+    case SrsMp4BoxTypeILST:
+        box = &Mp4ItemListBox{}
+    case SrsMp4BoxTypeCHPL:
+        box = &Mp4ChapterListBox{}
+    case SrsMp4BoxTypeMVEX:
+        box = &Mp4MovieExtendsBox{}
+    case SrsMp4BoxTypeTREX:
+        box = &Mp4TrackExtendsBox{}
+    case SrsMp4BoxTypeMOOF:
+        box = &Mp4MovieFragmentBox{}
+    case SrsMp4BoxTypeMFHD:
+        box = &Mp4MovieFragmentHeaderBox{}
+    case SrsMp4BoxTypeTRAF:
+        box = &Mp4TrackFragmentBox{}
+    case SrsMp4BoxTypeTFHD:
+        box = &Mp4TrackFragmentHeaderBox{}
+    case SrsMp4BoxTypeTFDT:
+        box = &Mp4TrackFragmentDecodeTimeBox{}
+    case SrsMp4BoxTypeTRUN:
+        box = NewMp4TrackFragmentRunBox()
     case SrsMp4BoxTypeMDAT:
         box = NewMp4MediaDataBox()
+    case SrsMp4BoxTypeSTYP, SrsMp4BoxTypeSIDX:
+        // The segment type and index of DASH segments, skip for the samples are in moof.
+        box = NewMp4FreeSpaceBox()
     default:
         box = NewMp4FreeSpaceBox()
     }
@@ -197,6 +294,30 @@ func (v *Mp4Box) discovery(r io.Reader) (box Box, err error) {
     return
 }
 
+// Get the size of box whose contents extend to the end of file,
+// including the header already read, the reader must be seekable.
+func (v *Mp4Box) sizeToEOF(r io.Reader) (size uint64, err error) {
+    s, ok := r.(io.Seeker)
+    if !ok {
+        err = fmt.Errorf("box to eof requires seekable reader")
+        return
+    }
+
+    var pos, end int64
+    if pos, err = s.Seek(0, io.SeekCurrent); err != nil {
+        return
+    }
+    if end, err = s.Seek(0, io.SeekEnd); err != nil {
+        return
+    }
+    if _, err = s.Seek(pos, io.SeekStart); err != nil {
+        return
+    }
+
+    size = uint64(end - pos) + v.UsedSize
+    return
+}
+
 func (v *Mp4Box) DecodeBoxes(r io.Reader) (err error) {
     // read left space
     left := v.left()
@@ -230,14 +351,40 @@ func (v *Mp4Box) DecodeBoxes(r io.Reader) (err error) {
     return
 }
 
+// Decode the contained boxes from data, ignore the tail which is less than a box header,
+// for example, the QuickTime udta maybe terminated by 4 bytes zero.
+func (v *Mp4Box) decodeBoxesFrom(data []uint8) (err error) {
+    r := bytes.NewReader(data)
+    for r.Len() >= 8 {
+        mb := NewMp4Box()
+        var box Box
+        if box, err = mb.discovery(r); err != nil {
+            ol.E(nil, fmt.Sprintf("mp4 discovery contained box failed, err is %v", err))
+            return
+        }
+
+        if err = box.DecodeHeader(r); err != nil {
+            ol.E(nil, fmt.Sprintf("mp4 decode contained box header failed, err is %v", err))
+            return
+        }
+        if err = box.Basic().DecodeBoxes(r); err != nil {
+            ol.E(nil, fmt.Sprintf("mp4 decode contained box boxes failed, err is %v", err))
+            return
+        }
+
+        v.Boxes = append(v.Boxes, box)
+    }
+    return
+}
+
 func (v *Mp4Box) Skip(r io.Reader, num uint64) {
     if num <= 0 {
         return
     }
 
-    data := make([]uint8, num)
-    v.Read(r, data)
-    //v.UsedSize += num
+    // Discard without buffering, the mdat maybe larger than 4GB.
+    n, _ := io.CopyN(ioutil.Discard, r, int64(num))
+    v.UsedSize += uint64(n)
     ol.I(nil, fmt.Sprintf("skip %v bytes", num))
 }
 
@@ -359,26 +506,85 @@ func (v *Mp4MovieBox) Mvhd() (*Mp4MovieHeaderBox, error) {
     }
 }
 
+// Get the first video track.
 func (v *Mp4MovieBox) Video() (*Mp4TrackBox, error) {
+    return v.SelectTrack(SrsMp4TrackTypeVideo, &Mp4TrackFilter{})
+}
+
+// Get the first audio track.
+func (v *Mp4MovieBox) Audio() (*Mp4TrackBox, error) {
+    return v.SelectTrack(SrsMp4TrackTypeAudio, &Mp4TrackFilter{})
+}
+
+// Get all the tracks in moov.
+func (v *Mp4MovieBox) Tracks() (tracks []*Mp4TrackBox) {
     for _, box := range v.Boxes {
         if tbox, ok := box.(*Mp4TrackBox); ok {
-            if tbox.trackType() == SrsMp4TrackTypeVideo {
-                return tbox, nil
-            }
+            tracks = append(tracks, tbox)
         }
     }
-    return nil, fmt.Errorf("can't find video trak box in moov")
+    return
 }
 
-func (v *Mp4MovieBox) Audio() (*Mp4TrackBox, error) {
-    for _, box := range v.Boxes {
-        if tbox, ok := box.(*Mp4TrackBox); ok {
-            if tbox.trackType() == SrsMp4TrackTypeAudio {
-                return tbox, nil
-            }
+// Get the first track of type which matches the filter.
+func (v *Mp4MovieBox) SelectTrack(trackType int, filter *Mp4TrackFilter) (*Mp4TrackBox, error) {
+    for _, tbox := range v.Tracks() {
+        if tbox.trackType() == trackType && filter.match(tbox) {
+            return tbox, nil
         }
     }
-    return nil, fmt.Errorf("can't find audio trak box in moov")
+
+    if trackType == SrsMp4TrackTypeVideo {
+        return nil, fmt.Errorf("can't find video trak box in moov, filter=%+v", *filter)
+    }
+    return nil, fmt.Errorf("can't find audio trak box in moov, filter=%+v", *filter)
+}
+
+// Get the movie extends box, which exists only for fragmented mp4.
+func (v *Mp4MovieBox) Mvex() (*Mp4MovieExtendsBox, error) {
+    if box, err := v.get(SrsMp4BoxTypeMVEX); err != nil {
+        return nil, err
+    } else {
+        return box.(*Mp4MovieExtendsBox), nil
+    }
+}
+
+// Whether the samples are in the movie fragments.
+func (v *Mp4MovieBox) Fragmented() bool {
+    _, err := v.Mvex()
+    return err == nil
+}
+
+// Get the iTunes metadata item list, in udta/meta/ilst, or meta/ilst in moov.
+func (v *Mp4MovieBox) Ilst() (*Mp4ItemListBox, error) {
+    if box, err := v.get(SrsMp4BoxTypeUDTA); err == nil {
+        if meta, err := box.(*Mp4UserDataBox).meta(); err == nil {
+            return meta.ilst()
+        }
+    }
+    if box, err := v.get(SrsMp4BoxTypeMETA); err == nil {
+        return box.(*Mp4MetaBox).ilst()
+    }
+    return nil, fmt.Errorf("can't find meta box in moov")
+}
+
+// Get the Nero chapter list in udta.
+func (v *Mp4MovieBox) Chpl() (*Mp4ChapterListBox, error) {
+    if box, err := v.get(SrsMp4BoxTypeUDTA); err != nil {
+        return nil, err
+    } else {
+        return box.(*Mp4UserDataBox).chpl()
+    }
+}
+
+// Get the track by track ID.
+func (v *Mp4MovieBox) Track(trackId uint32) (*Mp4TrackBox, error) {
+    for _, tbox := range v.Tracks() {
+        if tkhd, err := tbox.tkhd(); err == nil && tkhd.TrackId == trackId {
+            return tbox, nil
+        }
+    }
+    return nil, fmt.Errorf("can't find trak box of id %v in moov", trackId)
 }
 
 // Get the number of video tracks
@@ -413,6 +619,51 @@ func (v *Mp4MovieBox) NbHeader() int {
     return v.Mp4Box.NbHeader()
 }
 
+/**
+ * The filter to select track, the zero value field matches any track.
+ */
+type Mp4TrackFilter struct {
+    // The track id in tkhd.
+    TrackId uint32
+    // The ISO-639-2/T language code in mdhd, for example, eng.
+    Language string
+    // The human-readable name of track in hdlr.
+    HandlerName string
+}
+
+func (v *Mp4TrackFilter) match(track *Mp4TrackBox) bool {
+    info := track.Info()
+    if v.TrackId != 0 && v.TrackId != info.TrackId {
+        return false
+    }
+    if v.Language != "" && v.Language != info.Language {
+        return false
+    }
+    if v.HandlerName != "" && v.HandlerName != info.HandlerName {
+        return false
+    }
+    return true
+}
+
+/**
+ * The information of track, for user to select the track to convert.
+ */
+type Mp4TrackInfo struct {
+    TrackId uint32
+    // The track type, for example, audio, video or subtitle.
+    TrackType Mp4TrackType
+    // The FourCC of sample entry, for example, avc1 or mp4a.
+    Codec string
+    // The ISO-639-2/T language code, for example, eng.
+    Language string
+    // The human-readable name of track.
+    HandlerName string
+}
+
+func (v *Mp4TrackInfo) String() string {
+    return fmt.Sprintf("track:%v, type:%v, codec:%v, language:%v, name:%v", v.TrackId, v.TrackType, v.Codec, v.Language, v.HandlerName)
+}
+
 /**
  * 4.2 Object Structure
  * ISO_IEC_14496-12-base-format-2012.pdf, page 17
@@ -602,7 +853,16 @@ func (v *Mp4TrackBox) vide_codec() (codec int) {
     } else {
         entry := box.Entries[0]
         if _, ok := entry.(*Mp4VisualSampleEntry); ok {
-            codec = SrsVideoCodecIdAVC
+            switch entry.Basic().BoxType {
+            case SrsMp4BoxTypeAVC1:
+                codec = SrsVideoCodecIdAVC
+            case SrsMp4BoxTypeHVC1, SrsMp4BoxTypeHEV1:
+                codec = SrsVideoCodecIdHEVC
+            case SrsMp4BoxTypeAV01:
+                codec = SrsVideoCodecIdAV1
+            case SrsMp4BoxTypeVP09:
+                codec = SrsVideoCodecIdVP9
+            }
         }
     }
     return
@@ -616,13 +876,73 @@ func (v *Mp4TrackBox) soun_codec() (codec int) {
         return
     } else {
         entry := box.Entries[0]
-        if _, ok := entry.(*Mp4AudioSampleEntry); ok {
-            codec = SrsAudioCodecIdAAC
+        if mp4a, ok := entry.(*Mp4AudioSampleEntry); ok {
+            switch entry.Basic().BoxType {
+            case SrsMp4BoxTypeOPUS:
+                codec = SrsAudioCodecIdOpus
+            case SrsMp4BoxTypeFLAC:
+                codec = SrsAudioCodecIdFLAC
+            case SrsMp4BoxTypeAC3:
+                codec = SrsAudioCodecIdAC3
+            case SrsMp4BoxTypeEC3:
+                codec = SrsAudioCodecIdEAC3
+            case SrsMp4BoxTypeSOWT, SrsMp4BoxTypeTWOS, SrsMp4BoxTypeLPCM, SrsMp4BoxTypeIPCM:
+                codec = SrsAudioCodecIdLinearPCMLittleEndian
+            case SrsMp4BoxTypeALAW:
+                codec = SrsAudioCodecIdReservedG711AlawLogarithmicPCM
+            case SrsMp4BoxTypeULAW:
+                codec = SrsAudioCodecIdReservedG711MuLawLogarithmicPCM
+            default:
+                codec = SrsAudioCodecIdAAC
+                // The mp4a maybe MP3, by the objectTypeIndication of esds.
+                if esds, err := mp4a.esds(); err == nil {
+                    switch esds.objectType() {
+                    case SrsMp4ObjectTypeMp3, SrsMp4ObjectTypeMp3Mpeg2:
+                        codec = SrsAudioCodecIdMP3
+                    }
+                }
+            }
         }
     }
     return
 }
 
+// Get the sample entry type of subtitle, for example, tx3g, wvtt or text.
+func (v *Mp4TrackBox) text_codec() uint32 {
+    if stsd, err := v.stsd(); err == nil && len(stsd.Entries) > 0 {
+        return stsd.Entries[0].Basic().BoxType
+    }
+    return SrsMp4BoxTypeForbidden
+}
+
+// Get the information of track, the missing boxes are ignored.
+func (v *Mp4TrackBox) Info() *Mp4TrackInfo {
+    info := &Mp4TrackInfo{
+        TrackType: Mp4TrackType(v.trackType()),
+    }
+    if tkhd, err := v.tkhd(); err == nil {
+        info.TrackId = tkhd.TrackId
+    }
+    if mdhd, err := v.mdhd(); err == nil {
+        info.Language = mdhd.language()
+    }
+    if hdlr, err := v.hdlr(); err == nil {
+        info.HandlerName = hdlr.name()
+    }
+    if stsd, err := v.stsd(); err == nil && len(stsd.Entries) > 0 {
+        info.Codec = fourCCString(stsd.Entries[0].Basic().BoxType)
+    }
+    return info
+}
+
+func (v *Mp4TrackBox) hdlr() (*Mp4HandlerReferenceBox, error) {
+    if box, err := v.mdia(); err != nil {
+        return nil, err
+    } else {
+        return box.hdlr()
+    }
+}
+
 func (v *Mp4TrackBox) trackType() int {
     if box, err := v.get(SrsMp4BoxTypeMDIA); err != nil {
         return SrsMp4TrackTypeForbidden
@@ -664,6 +984,25 @@ func (v *Mp4TrackBox) stsz() (*Mp4SampleSizeBox, error) {
     }
 }
 
+func (v *Mp4TrackBox) stz2() (*Mp4CompactSampleSizeBox, error) {
+    if box, err := v.stbl(); err != nil {
+        return nil, err
+    } else {
+        return box.stz2()
+    }
+}
+
+// The number of samples in stbl, which is zero when all samples are in the movie fragments.
+func (v *Mp4TrackBox) nbSamples() uint32 {
+    if stsz, err := v.stsz(); err == nil {
+        return stsz.getSampleCount()
+    }
+    if stz2, err := v.stz2(); err == nil {
+        return stz2.getSampleCount()
+    }
+    return 0
+}
+
 func (v *Mp4TrackBox) stss() (*Mp4SyncSampleBox, error) {
     if box, err := v.stbl(); err != nil {
         return nil, err
@@ -680,6 +1019,14 @@ func (v *Mp4TrackBox) stco() (*Mp4ChunkOffsetBox, error) {
     }
 }
 
+func (v *Mp4TrackBox) co64() (*Mp4ChunkLargeOffsetBox, error) {
+    if box, err := v.stbl(); err != nil {
+        return nil, err
+    } else {
+        return box.co64()
+    }
+}
+
 func (v *Mp4TrackBox) mdhd() (*Mp4MediaHeaderBox, error) {
     if box, err := v.mdia(); err != nil {
         return nil, err
@@ -688,6 +1035,48 @@ func (v *Mp4TrackBox) mdhd() (*Mp4MediaHeaderBox, error) {
     }
 }
 
+func (v *Mp4TrackBox) tkhd() (*Mp4TrackHeaderBox, error) {
+    if box, err := v.get(SrsMp4BoxTypeTKHD); err != nil {
+        return nil, err
+    } else {
+        return box.(*Mp4TrackHeaderBox), nil
+    }
+}
+
+func (v *Mp4TrackBox) tref() (*Mp4TrackReferenceBox, error) {
+    if box, err := v.get(SrsMp4BoxTypeTREF); err != nil {
+        return nil, err
+    } else {
+        return box.(*Mp4TrackReferenceBox), nil
+    }
+}
+
+// Get the track IDs of the QuickTime chapter text track.
+func (v *Mp4TrackBox) chapterTrackIds() []uint32 {
+    if tref, err := v.tref(); err == nil {
+        if chap, err := tref.chap(); err == nil {
+            return chap.trackIds
+        }
+    }
+    return nil
+}
+
+func (v *Mp4TrackBox) edts() (*Mp4EditBox, error) {
+    if box, err := v.get(SrsMp4BoxTypeEDTS); err != nil {
+        return nil, err
+    } else {
+        return box.(*Mp4EditBox), nil
+    }
+}
+
+func (v *Mp4TrackBox) elst() (*Mp4EditListBox, error) {
+    if box, err := v.edts(); err != nil {
+        return nil, err
+    } else {
+        return box.elst()
+    }
+}
+
 func (v *Mp4TrackBox) mdia() (*Mp4MediaBox, error) {
     if box, err := v.get(SrsMp4BoxTypeMDIA); err != nil {
         return nil, err
@@ -744,6 +1133,30 @@ func (v *Mp4TrackBox) avcc() (*Mp4AvccBox, error) {
     }
 }
 
+func (v *Mp4TrackBox) hvcc() (*Mp4HvccBox, error) {
+    if box, err := v.avc1(); err != nil {
+        return nil, err
+    } else {
+        return box.hvcc()
+    }
+}
+
+func (v *Mp4TrackBox) av1c() (*Mp4Av1cBox, error) {
+    if box, err := v.avc1(); err != nil {
+        return nil, err
+    } else {
+        return box.av1c()
+    }
+}
+
+func (v *Mp4TrackBox) vpcc() (*Mp4VpccBox, error) {
+    if box, err := v.avc1(); err != nil {
+        return nil, err
+    } else {
+        return box.vpcc()
+    }
+}
+
 func (v *Mp4TrackBox) asc() (*Mp4DecoderSpecificInfo, error) {
     if box, err := v.mp4a(); err != nil {
         return nil, err
@@ -887,92 +1300,270 @@ func (v *Mp4TrackHeaderBox) DecodeHeader(r io.Reader) (err error) {
 }
 
 /**
- * 8.4.1 Media Box (mdia)
- * ISO_IEC_14496-12-base-format-2012.pdf, page 36
- * The media declaration container contains all the objects that declare information about the media data within a
- * track.
+ * 8.3.3 Track Reference Box (tref)
+ * ISO_IEC_14496-12-base-format-2012.pdf
+ * This box provides a reference from the containing track to another track in the presentation.
+ * The references are typed, for example, the 'chap' of QuickTime references the chapter text track.
  */
-type Mp4MediaBox struct {
+type Mp4TrackReferenceBox struct {
     Mp4Box
 }
 
-func (v *Mp4MediaBox) Basic() *Mp4Box {
+func (v *Mp4TrackReferenceBox) Basic() *Mp4Box {
     return &v.Mp4Box
 }
 
-func (v *Mp4MediaBox) mdhd() (*Mp4MediaHeaderBox, error) {
-    if box, err := v.get(SrsMp4BoxTypeMDHD); err != nil {
+func (v *Mp4TrackReferenceBox) chap() (*Mp4TrackReferenceTypeBox, error) {
+    if box, err := v.get(SrsMp4BoxTypeCHAP); err != nil {
         return nil, err
     } else {
-        return box.(*Mp4MediaHeaderBox), nil
+        return box.(*Mp4TrackReferenceTypeBox), nil
     }
 }
 
-func (v *Mp4MediaBox) minf() (*Mp4MediaInformationBox, error) {
-    if box, err := v.get(SrsMp4BoxTypeMINF); err != nil {
-        return nil, err
-    } else {
-        return box.(*Mp4MediaInformationBox), nil
-    }
+/**
+ * The typed reference in tref, the box type is the reference type.
+ */
+type Mp4TrackReferenceTypeBox struct {
+    Mp4Box
+    // The track IDs of referenced tracks, the zero is not allowed.
+    trackIds []uint32
 }
 
-func (v *Mp4MediaBox) trackType() int {
-    if box, err := v.get(SrsMp4BoxTypeHDLR); err != nil {
-        return SrsMp4TrackTypeForbidden
-    } else {
-        hdlr := box.(*Mp4HandlerReferenceBox)
-        if hdlr.HandlerType == SrsMp4HandlerTypeSOUN {
-            return SrsMp4TrackTypeAudio
-        }
-        if hdlr.HandlerType == SrsMp4HandlerTypeVIDE {
-            return SrsMp4TrackTypeVideo
+func (v *Mp4TrackReferenceTypeBox) Basic() *Mp4Box {
+    return &v.Mp4Box
+}
+
+func (v *Mp4TrackReferenceTypeBox) DecodeHeader(r io.Reader) (err error) {
+    for v.left() >= 4 {
+        var trackId uint32
+        if err = v.Read(r, &trackId); err != nil {
+            ol.E(nil, fmt.Sprintf("read tref track id failed, err is %v", err))
+            return
         }
+        v.trackIds = append(v.trackIds, trackId)
     }
-    return SrsMp4TrackTypeForbidden
+    v.Skip(r, v.left())
+
+    ol.I(nil, fmt.Sprintf("decode %v box success, track ids=%v", fourCCString(v.BoxType), v.trackIds))
+    return
 }
 
 /**
- * 8.4.2 Media Header Box (mdhd)
- * ISO_IEC_14496-12-base-format-2012.pdf, page 36
- * The media declaration container contains all the objects that declare information about the media data within a
- * track.
+ * 8.6.5 Edit Box (edts)
+ * ISO_IEC_14496-12-base-format-2012.pdf, page 54
+ * An Edit Box maps the presentation time-line to the media time-line as it is stored in the file.
+ * The Edit Box is a container for the edit lists.
  */
-type Mp4MediaHeaderBox struct {
-    Mp4FullBox
-    // an integer that declares the creation time of the presentation (in seconds since
-    // midnight, Jan. 1, 1904, in UTC time)
-    CreateTime uint64
-    // an integer that declares the most recent time the presentation was modified (in
-    // seconds since midnight, Jan. 1, 1904, in UTC time)
-    ModTime    uint64
-    // an integer that specifies the time-scale for the entire presentation; this is the number of
-    // time units that pass in one second. For example, a time coordinate system that measures time in
-    // sixtieths of a second has a time scale of 60.
-    TimeScale  uint32
-    // an integer that declares length of the presentation (in the indicated timescale). This property
-    // is derived from the presentation’s tracks: the value of this field corresponds to the duration of the
-    // longest track in the presentation. If the duration cannot be determined then duration is set to all 1s.
-    Duration   uint64
-    // the language code for this media. See ISO 639-2/T for the set of three character
-    // codes. Each character is packed as the difference between its ASCII value and 0x60. Since the code
-    // is confined to being three lower-case letters, these values are strictly positive.
-    Language   uint16
-    PreDefined uint16
+type Mp4EditBox struct {
+    Mp4Box
 }
 
-func (v *Mp4MediaHeaderBox) Basic() *Mp4Box {
-    return &v.Mp4FullBox.Mp4Box
+func (v *Mp4EditBox) Basic() *Mp4Box {
+    return &v.Mp4Box
 }
 
-func (v *Mp4MediaHeaderBox) DecodeHeader(r io.Reader) (err error) {
-    if err = v.Mp4FullBox.DecodeHeader(r); err != nil {
-        return
+func (v *Mp4EditBox) elst() (*Mp4EditListBox, error) {
+    if box, err := v.get(SrsMp4BoxTypeELST); err != nil {
+        return nil, err
+    } else {
+        return box.(*Mp4EditListBox), nil
     }
+}
 
-    if v.Version == 1 {
-        if err = v.Read(r, &v.CreateTime); err != nil {
-            ol.E(nil, fmt.Sprintf("mdhd read create time failed, err is %v", err))
-            return
+/**
+ * 8.6.6 Edit List Box (elst)
+ * ISO_IEC_14496-12-base-format-2012.pdf, page 55
+ */
+type Mp4ElstEntry struct {
+    // an integer that specifies the duration of this edit segment in units of the timescale
+    // in the Movie Header Box
+    segmentDuration uint64
+    // an integer containing the starting time within the media of this edit segment (in media time
+    // scale units, in composition time). If this field is set to –1, it is an empty edit. The last edit in a track
+    // shall never be an empty edit.
+    mediaTime int64
+    // specifies the relative rate at which to play the media corresponding to this edit segment.
+    mediaRateInteger int16
+    mediaRateFraction int16
+}
+
+/**
+ * 8.6.6 Edit List Box (elst)
+ * ISO_IEC_14496-12-base-format-2012.pdf, page 55
+ * This box contains an explicit timeline map. Each entry defines part of the track time-line: by mapping part of
+ * the media time-line, or by indicating ‘empty’ time, or by defining a ‘dwell’, where a single time-point in the
+ * media is held for a period.
+ */
+type Mp4EditListBox struct {
+    Mp4FullBox
+    // an integer that gives the number of entries in the following table
+    entryCount uint32
+    entries []*Mp4ElstEntry
+}
+
+func NewMp4EditListBox() *Mp4EditListBox {
+    v := &Mp4EditListBox{
+        entries: []*Mp4ElstEntry{},
+    }
+    return v
+}
+
+func (v *Mp4EditListBox) Basic() *Mp4Box {
+    return &v.Mp4Box
+}
+
+func (v *Mp4EditListBox) DecodeHeader(r io.Reader) (err error) {
+    if err = v.Mp4FullBox.DecodeHeader(r); err != nil {
+        return
+    }
+
+    if err = v.Read(r, &v.entryCount); err != nil {
+        ol.E(nil, fmt.Sprintf("read elst entry count failed, err is %v", err))
+        return
+    }
+
+    for i := 0; i < int(v.entryCount); i++ {
+        entry := &Mp4ElstEntry{}
+        if v.Version == 1 {
+            if err = v.Read(r, &entry.segmentDuration); err != nil {
+                ol.E(nil, fmt.Sprintf("read elst %v segment duration failed, err is %v", i, err))
+                return
+            }
+            if err = v.Read(r, &entry.mediaTime); err != nil {
+                ol.E(nil, fmt.Sprintf("read elst %v media time failed, err is %v", i, err))
+                return
+            }
+        } else {
+            var duration uint32
+            if err = v.Read(r, &duration); err != nil {
+                ol.E(nil, fmt.Sprintf("read elst %v segment duration failed, err is %v", i, err))
+                return
+            }
+            entry.segmentDuration = uint64(duration)
+
+            var mediaTime int32
+            if err = v.Read(r, &mediaTime); err != nil {
+                ol.E(nil, fmt.Sprintf("read elst %v media time failed, err is %v", i, err))
+                return
+            }
+            entry.mediaTime = int64(mediaTime)
+        }
+
+        if err = v.Read(r, &entry.mediaRateInteger); err != nil {
+            ol.E(nil, fmt.Sprintf("read elst %v media rate integer failed, err is %v", i, err))
+            return
+        }
+        if err = v.Read(r, &entry.mediaRateFraction); err != nil {
+            ol.E(nil, fmt.Sprintf("read elst %v media rate fraction failed, err is %v", i, err))
+            return
+        }
+        v.entries = append(v.entries, entry)
+    }
+
+    ol.I(nil, fmt.Sprintf("decode elst box success, box=%+v", v))
+    return
+}
+
+/**
+ * 8.4.1 Media Box (mdia)
+ * ISO_IEC_14496-12-base-format-2012.pdf, page 36
+ * The media declaration container contains all the objects that declare information about the media data within a
+ * track.
+ */
+type Mp4MediaBox struct {
+    Mp4Box
+}
+
+func (v *Mp4MediaBox) Basic() *Mp4Box {
+    return &v.Mp4Box
+}
+
+func (v *Mp4MediaBox) mdhd() (*Mp4MediaHeaderBox, error) {
+    if box, err := v.get(SrsMp4BoxTypeMDHD); err != nil {
+        return nil, err
+    } else {
+        return box.(*Mp4MediaHeaderBox), nil
+    }
+}
+
+func (v *Mp4MediaBox) minf() (*Mp4MediaInformationBox, error) {
+    if box, err := v.get(SrsMp4BoxTypeMINF); err != nil {
+        return nil, err
+    } else {
+        return box.(*Mp4MediaInformationBox), nil
+    }
+}
+
+func (v *Mp4MediaBox) hdlr() (*Mp4HandlerReferenceBox, error) {
+    if box, err := v.get(SrsMp4BoxTypeHDLR); err != nil {
+        return nil, err
+    } else {
+        return box.(*Mp4HandlerReferenceBox), nil
+    }
+}
+
+func (v *Mp4MediaBox) trackType() int {
+    if box, err := v.get(SrsMp4BoxTypeHDLR); err != nil {
+        return SrsMp4TrackTypeForbidden
+    } else {
+        hdlr := box.(*Mp4HandlerReferenceBox)
+        if hdlr.HandlerType == SrsMp4HandlerTypeSOUN {
+            return SrsMp4TrackTypeAudio
+        }
+        if hdlr.HandlerType == SrsMp4HandlerTypeVIDE {
+            return SrsMp4TrackTypeVideo
+        }
+        switch hdlr.HandlerType {
+        case SrsMp4HandlerTypeSBTL, SrsMp4HandlerTypeSUBT, SrsMp4HandlerTypeTEXT:
+            return SrsMp4TrackTypeSubtitle
+        }
+    }
+    return SrsMp4TrackTypeForbidden
+}
+
+/**
+ * 8.4.2 Media Header Box (mdhd)
+ * ISO_IEC_14496-12-base-format-2012.pdf, page 36
+ * The media declaration container contains all the objects that declare information about the media data within a
+ * track.
+ */
+type Mp4MediaHeaderBox struct {
+    Mp4FullBox
+    // an integer that declares the creation time of the presentation (in seconds since
+    // midnight, Jan. 1, 1904, in UTC time)
+    CreateTime uint64
+    // an integer that declares the most recent time the presentation was modified (in
+    // seconds since midnight, Jan. 1, 1904, in UTC time)
+    ModTime    uint64
+    // an integer that specifies the time-scale for the entire presentation; this is the number of
+    // time units that pass in one second. For example, a time coordinate system that measures time in
+    // sixtieths of a second has a time scale of 60.
+    TimeScale  uint32
+    // an integer that declares length of the presentation (in the indicated timescale). This property
+    // is derived from the presentation’s tracks: the value of this field corresponds to the duration of the
+    // longest track in the presentation. If the duration cannot be determined then duration is set to all 1s.
+    Duration   uint64
+    // the language code for this media. See ISO 639-2/T for the set of three character
+    // codes. Each character is packed as the difference between its ASCII value and 0x60. Since the code
+    // is confined to being three lower-case letters, these values are strictly positive.
+    Language   uint16
+    PreDefined uint16
+}
+
+func (v *Mp4MediaHeaderBox) Basic() *Mp4Box {
+    return &v.Mp4FullBox.Mp4Box
+}
+
+func (v *Mp4MediaHeaderBox) DecodeHeader(r io.Reader) (err error) {
+    if err = v.Mp4FullBox.DecodeHeader(r); err != nil {
+        return
+    }
+
+    if v.Version == 1 {
+        if err = v.Read(r, &v.CreateTime); err != nil {
+            ol.E(nil, fmt.Sprintf("mdhd read create time failed, err is %v", err))
+            return
         }
 
         if err = v.Read(r, &v.ModTime); err != nil {
@@ -1025,6 +1616,18 @@ func (v *Mp4MediaHeaderBox) DecodeHeader(r io.Reader) (err error) {
     return
 }
 
+// Get the ISO-639-2/T language code, each character is packed as 5 bits.
+func (v *Mp4MediaHeaderBox) language() string {
+    if v.Language == 0 {
+        return ""
+    }
+    return string([]byte{
+        byte((v.Language >> 10) & 0x1f) + 0x60,
+        byte((v.Language >> 5) & 0x1f) + 0x60,
+        byte(v.Language & 0x1f) + 0x60,
+    })
+}
+
 /**
  * 8.4.3 Handler Reference Box (hdlr)
  * ISO_IEC_14496-12-base-format-2012.pdf, page 37
@@ -1084,6 +1687,15 @@ func (v *Mp4HandlerReferenceBox) DecodeHeader(r io.Reader) (err error) {
     return
 }
 
+// Get the name without the null-terminator, the QuickTime name is a pascal string.
+func (v *Mp4HandlerReferenceBox) name() string {
+    name := strings.TrimRight(v.Name, "\x00")
+    if len(name) > 0 && int(name[0]) == len(name) - 1 {
+        name = name[1:]
+    }
+    return name
+}
+
 /**
  * 8.4.4 Media Information Box (minf)
  * ISO_IEC_14496-12-base-format-2012.pdf, page 38
@@ -1220,6 +1832,14 @@ func (v *Mp4SampleTableBox) stsz() (*Mp4SampleSizeBox, error) {
     }
 }
 
+func (v *Mp4SampleTableBox) stz2() (*Mp4CompactSampleSizeBox, error) {
+    if box, err := v.get(SrsMp4BoxTypeSTZ2); err != nil {
+        return nil, err
+    } else {
+        return box.(*Mp4CompactSampleSizeBox), nil
+    }
+}
+
 func (v *Mp4SampleTableBox) stco() (*Mp4ChunkOffsetBox, error) {
     if box, err := v.get(SrsMp4BoxTypeSTCO); err != nil {
         return nil, err
@@ -1228,6 +1848,14 @@ func (v *Mp4SampleTableBox) stco() (*Mp4ChunkOffsetBox, error) {
     }
 }
 
+func (v *Mp4SampleTableBox) co64() (*Mp4ChunkLargeOffsetBox, error) {
+    if box, err := v.get(SrsMp4BoxTypeCO64); err != nil {
+        return nil, err
+    } else {
+        return box.(*Mp4ChunkLargeOffsetBox), nil
+    }
+}
+
 func (v *Mp4SampleTableBox) stsd() (*Mp4SampleDescritionBox, error) {
     if box, err := v.get(SrsMp4BoxTypeSTSD); err != nil {
         return nil, err
@@ -1361,6 +1989,30 @@ func (v *Mp4VisualSampleEntry) avcc() (*Mp4AvccBox, error) {
     }
 }
 
+func (v *Mp4VisualSampleEntry) hvcc() (*Mp4HvccBox, error) {
+    if box, err := v.get(SrsMp4BoxTypeHVCC); err != nil {
+        return nil, err
+    } else {
+        return box.(*Mp4HvccBox), nil
+    }
+}
+
+func (v *Mp4VisualSampleEntry) av1c() (*Mp4Av1cBox, error) {
+    if box, err := v.get(SrsMp4BoxTypeAV1C); err != nil {
+        return nil, err
+    } else {
+        return box.(*Mp4Av1cBox), nil
+    }
+}
+
+func (v *Mp4VisualSampleEntry) vpcc() (*Mp4VpccBox, error) {
+    if box, err := v.get(SrsMp4BoxTypeVPCC); err != nil {
+        return nil, err
+    } else {
+        return box.(*Mp4VpccBox), nil
+    }
+}
+
 /**
  * 5.3.4 AVC Video Stream Definition (avcC)
  * ISO_IEC_14496-15-AVC-format-2012.pdf, page 19
@@ -1386,18 +2038,209 @@ func (v *Mp4AvccBox) DecodeHeader(r io.Reader) (err error) {
     return
 }
 
+// Get the size of NALU length in bytes, the lengthSizeMinusOne plus one.
+func (v *Mp4AvccBox) naluLengthSize() (int, error) {
+    if record, err := v.record(); err != nil {
+        return 0, err
+    } else {
+        return record.naluLengthSize, nil
+    }
+}
+
+// Parse the AVCDecoderConfigurationRecord, for the profile, level and SPS/PPS.
+func (v *Mp4AvccBox) record() (*AvcDecoderConfigurationRecord, error) {
+    record := NewAvcDecoderConfigurationRecord()
+    if err := record.Decode(v.avcConfig); err != nil {
+        return nil, err
+    }
+    return record, nil
+}
+
+/**
+ * 8.4.1 HEVC Video Stream Definition (hvcC)
+ * ISO_IEC_14496-15-AVC-format-2014.pdf, page 68
+ * The HEVCDecoderConfigurationRecord, contains the VPS/SPS/PPS.
+ */
+type Mp4HvccBox struct {
+    Mp4Box
+    nbConfig int
+    hevcConfig []uint8
+}
+
+func (v *Mp4HvccBox) Basic() *Mp4Box {
+    return &v.Mp4Box
+}
+
+func (v *Mp4HvccBox) DecodeHeader(r io.Reader) (err error) {
+    v.nbConfig = int(v.left())
+    v.hevcConfig = make([]uint8, v.nbConfig)
+    if err = v.Read(r, v.hevcConfig); err != nil {
+        ol.E(nil, fmt.Sprintf("read hvcc config failed, err is %v", err))
+        return
+    }
+    ol.T(nil, fmt.Sprintf("read hvcc box success, nv config=%v", v.nbConfig))
+    return
+}
+
+/**
+ * AV1 Codec Configuration Box (av1C)
+ * The AV1CodecConfigurationRecord, in AV1 Codec ISO Media File Format Binding.
+ * @see https://aomediacodec.github.io/av1-isobmff/#av1codecconfigurationbox-section
+ */
+type Mp4Av1cBox struct {
+    Mp4Box
+    marker uint8 // bit(1), always 1
+    version uint8 // bit(7), always 1
+    seqProfile uint8 // bit(3)
+    seqLevelIdx0 uint8 // bit(5)
+    seqTier0 uint8 // bit(1)
+    highBitdepth uint8 // bit(1)
+    twelveBit uint8 // bit(1)
+    monochrome uint8 // bit(1)
+    chromaSubsamplingX uint8 // bit(1)
+    chromaSubsamplingY uint8 // bit(1)
+    chromaSamplePosition uint8 // bit(2)
+    initialPresentationDelayPresent uint8 // bit(1)
+    initialPresentationDelayMinusOne uint8 // bit(4)
+    // The OBUs, generally the sequence header OBU.
+    configOBUs []uint8
+
+    // The whole AV1CodecConfigurationRecord, for the sequence header of enhanced RTMP.
+    nbConfig int
+    av1Config []uint8
+}
+
+func (v *Mp4Av1cBox) Basic() *Mp4Box {
+    return &v.Mp4Box
+}
+
+func (v *Mp4Av1cBox) DecodeHeader(r io.Reader) (err error) {
+    v.nbConfig = int(v.left())
+    if v.nbConfig < 4 {
+        err = fmt.Errorf("MP4 illegal av1C, size=%v", v.nbConfig)
+        ol.E(nil, err.Error())
+        return
+    }
+
+    v.av1Config = make([]uint8, v.nbConfig)
+    if err = v.Read(r, v.av1Config); err != nil {
+        ol.E(nil, fmt.Sprintf("read av1c config failed, err is %v", err))
+        return
+    }
+
+    p := v.av1Config
+    v.marker = (p[0] >> 7) & 0x01
+    v.version = p[0] & 0x7f
+    v.seqProfile = (p[1] >> 5) & 0x07
+    v.seqLevelIdx0 = p[1] & 0x1f
+    v.seqTier0 = (p[2] >> 7) & 0x01
+    v.highBitdepth = (p[2] >> 6) & 0x01
+    v.twelveBit = (p[2] >> 5) & 0x01
+    v.monochrome = (p[2] >> 4) & 0x01
+    v.chromaSubsamplingX = (p[2] >> 3) & 0x01
+    v.chromaSubsamplingY = (p[2] >> 2) & 0x01
+    v.chromaSamplePosition = p[2] & 0x03
+    v.initialPresentationDelayPresent = (p[3] >> 4) & 0x01
+    v.initialPresentationDelayMinusOne = p[3] & 0x0f
+    v.configOBUs = p[4:]
+
+    if v.marker != 1 || v.version != 1 {
+        err = fmt.Errorf("MP4 illegal av1C, marker=%v, version=%v", v.marker, v.version)
+        ol.E(nil, err.Error())
+        return
+    }
+
+    ol.T(nil, fmt.Sprintf("read av1c box success, profile=%v, level=%v, nb config=%v", v.seqProfile, v.seqLevelIdx0, v.nbConfig))
+    return
+}
+
+/**
+ * VP Codec Configuration Box (vpcC)
+ * The VPCodecConfigurationRecord, in VP Codec ISO Media File Format Binding.
+ * @see https://www.webmproject.org/vp9/mp4/
+ */
+type Mp4VpccBox struct {
+    Mp4Box
+    // The FullBox version and flags, version shall be 1.
+    version uint8
+    flags uint32
+    profile uint8
+    level uint8
+    bitDepth uint8 // bit(4)
+    chromaSubsampling uint8 // bit(3)
+    videoFullRangeFlag uint8 // bit(1)
+    colourPrimaries uint8
+    transferCharacteristics uint8
+    matrixCoefficients uint8
+    // Not used for VP8 and VP9, shall be zero size.
+    codecInitializationData []uint8
+
+    // The whole box payload including version and flags, for the sequence header of enhanced RTMP.
+    nbConfig int
+    vpConfig []uint8
+}
+
+func (v *Mp4VpccBox) Basic() *Mp4Box {
+    return &v.Mp4Box
+}
+
+func (v *Mp4VpccBox) DecodeHeader(r io.Reader) (err error) {
+    v.nbConfig = int(v.left())
+    if v.nbConfig < 12 {
+        err = fmt.Errorf("MP4 illegal vpcC, size=%v", v.nbConfig)
+        ol.E(nil, err.Error())
+        return
+    }
+
+    v.vpConfig = make([]uint8, v.nbConfig)
+    if err = v.Read(r, v.vpConfig); err != nil {
+        ol.E(nil, fmt.Sprintf("read vpcc config failed, err is %v", err))
+        return
+    }
+
+    p := v.vpConfig
+    v.version = p[0]
+    v.flags = Bytes3ToUint32(p[1:4])
+    v.profile = p[4]
+    v.level = p[5]
+    v.bitDepth = (p[6] >> 4) & 0x0f
+    v.chromaSubsampling = (p[6] >> 1) & 0x07
+    v.videoFullRangeFlag = p[6] & 0x01
+    v.colourPrimaries = p[7]
+    v.transferCharacteristics = p[8]
+    v.matrixCoefficients = p[9]
+
+    nbInit := int(binary.BigEndian.Uint16(p[10:12]))
+    if 12 + nbInit > v.nbConfig {
+        err = fmt.Errorf("MP4 illegal vpcC, init data size=%v, left=%v", nbInit, v.nbConfig - 12)
+        ol.E(nil, err.Error())
+        return
+    }
+    v.codecInitializationData = p[12:12 + nbInit]
+
+    ol.T(nil, fmt.Sprintf("read vpcc box success, profile=%v, level=%v, bit depth=%v", v.profile, v.level, v.bitDepth))
+    return
+}
+
 /**
  * 8.5.2 Sample Description Box (mp4a)
  * ISO_IEC_14496-12-base-format-2012.pdf, page 45
  */
 type Mp4AudioSampleEntry struct {
     Mp4SampleEntry
-    reserved0 uint64
+    // For QuickTime, the version of sound description, the reserved for ISO.
+    version uint16
+    reserved0 [6]uint8
     channelCount uint16
     sampleSize uint16
     preDefined0 uint16
     reserved1 uint16
     sampleRate uint32
+
+    // For QuickTime version 2, the sample rate in float64 and the LPCM flags, the channels
+    // and bits per channel are set to channelCount and sampleSize.
+    audioSampleRate float64
+    formatSpecificFlags uint32
 }
 
 func (v *Mp4AudioSampleEntry) DecodeHeader(r io.Reader) (err error) {
@@ -1405,7 +2248,11 @@ func (v *Mp4AudioSampleEntry) DecodeHeader(r io.Reader) (err error) {
         return
     }
 
-    v.Skip(r, uint64(8))
+    if err = v.Read(r, &v.version); err != nil {
+        ol.E(nil, fmt.Sprintf("read mp4a version failed, err is %v", err))
+        return
+    }
+    v.Skip(r, uint64(6))
 
     if err = v.Read(r, &v.channelCount); err != nil {
         ol.E(nil, fmt.Sprintf("read mp4a channel count failed, err is %v", err))
@@ -1425,13 +2272,194 @@ func (v *Mp4AudioSampleEntry) DecodeHeader(r io.Reader) (err error) {
         return
     }
 
+    // The QuickTime sound description version 1 has 16 bytes for compressed audio, and the
+    // version 2 has 36 bytes, before the extensions.
+    switch v.version {
+    case 1:
+        v.Skip(r, uint64(16))
+    case 2:
+        if err = v.decodeVersion2(r); err != nil {
+            return
+        }
+    }
+
     ol.T(nil, fmt.Sprintf("decode mp4a succes, data:%+v %v", v, v.left()))
     return
 }
 
-func (v *Mp4AudioSampleEntry) esds() (*Mp4EsdsBox, error) {
-    if box, err := v.get(SrsMp4BoxTypeESDS); err != nil {
-        return nil, err
+/**
+ * Sound Sample Description (Version 2)
+ * QuickTime File Format Specification, Sound Sample Descriptions
+ */
+func (v *Mp4AudioSampleEntry) decodeVersion2(r io.Reader) (err error) {
+    var sizeOfStructOnly, numAudioChannels, always7F000000, constBitsPerChannel uint32
+    var audioSampleRate uint64
+    for _, field := range []interface{}{&sizeOfStructOnly, &audioSampleRate, &numAudioChannels, &always7F000000,
+        &constBitsPerChannel, &v.formatSpecificFlags} {
+        if err = v.Read(r, field); err != nil {
+            ol.E(nil, fmt.Sprintf("read mp4a version 2 failed, err is %v", err))
+            return
+        }
+    }
+
+    // The constBytesPerAudioPacket and constLPCMFramesPerAudioPacket.
+    v.Skip(r, uint64(8))
+
+    v.audioSampleRate = math.Float64frombits(audioSampleRate)
+    v.channelCount = uint16(numAudioChannels)
+    v.sampleSize = uint16(constBitsPerChannel)
+    return
+}
+
+// Get the sample rate in Hz.
+func (v *Mp4AudioSampleEntry) rate() uint32 {
+    if v.version == 2 {
+        return uint32(v.audioSampleRate)
+    }
+    return v.sampleRate >> 16
+}
+
+func (v *Mp4AudioSampleEntry) pcmC() (*Mp4PcmConfigBox, error) {
+    if box, err := v.get(SrsMp4BoxTypePCMC); err != nil {
+        return nil, err
+    } else {
+        return box.(*Mp4PcmConfigBox), nil
+    }
+}
+
+/**
+ * PCM configuration box (pcmC), for ipcm and fpcm.
+ * ISO/IEC 23003-5, 5.2 PCM configuration
+ */
+type Mp4PcmConfigBox struct {
+    Mp4FullBox
+    // The bit 0 is set for little-endian.
+    formatFlags uint8
+    sampleSize uint8
+}
+
+func (v *Mp4PcmConfigBox) Basic() *Mp4Box {
+    return &v.Mp4FullBox.Mp4Box
+}
+
+func (v *Mp4PcmConfigBox) NbHeader() int {
+    return v.Mp4FullBox.NbHeader()
+}
+
+func (v *Mp4PcmConfigBox) DecodeHeader(r io.Reader) (err error) {
+    if err = v.Mp4FullBox.DecodeHeader(r); err != nil {
+        return
+    }
+
+    if err = v.Read(r, &v.formatFlags); err != nil {
+        ol.E(nil, fmt.Sprintf("read pcmC format flags failed, err is %v", err))
+        return
+    }
+    if err = v.Read(r, &v.sampleSize); err != nil {
+        ol.E(nil, fmt.Sprintf("read pcmC sample size failed, err is %v", err))
+        return
+    }
+
+    ol.T(nil, fmt.Sprintf("read pcmC box success, flags=%v, sample size=%v", v.formatFlags, v.sampleSize))
+    return
+}
+
+func (v *Mp4PcmConfigBox) littleEndian() bool {
+    return v.formatFlags & 0x01 == 0x01
+}
+
+/**
+ * 3GPP timed text sample entry (tx3g), the font table is a contained box.
+ * 3GPP TS 26.245, 5.16 Sample Description Format
+ * The text sample is the 16 bits length and the text, then the modifier boxes.
+ */
+type Mp4TextSampleEntry struct {
+    Mp4SampleEntry
+    displayFlags uint32
+    horizontalJustification int8
+    verticalJustification int8
+    // The background color in RGBA.
+    backgroundColor [4]uint8
+    // The default text box, in top, left, bottom and right.
+    defaultTextBox [4]int16
+}
+
+func (v *Mp4TextSampleEntry) DecodeHeader(r io.Reader) (err error) {
+    if err = v.Mp4SampleEntry.DecodeHeader(r); err != nil {
+        return
+    }
+
+    if err = v.Read(r, &v.displayFlags); err != nil {
+        ol.E(nil, fmt.Sprintf("read tx3g display flags failed, err is %v", err))
+        return
+    }
+    if err = v.Read(r, &v.horizontalJustification); err != nil {
+        ol.E(nil, fmt.Sprintf("read tx3g horizontal justification failed, err is %v", err))
+        return
+    }
+    if err = v.Read(r, &v.verticalJustification); err != nil {
+        ol.E(nil, fmt.Sprintf("read tx3g vertical justification failed, err is %v", err))
+        return
+    }
+    if err = v.Read(r, v.backgroundColor[:]); err != nil {
+        ol.E(nil, fmt.Sprintf("read tx3g background color failed, err is %v", err))
+        return
+    }
+    for i := range v.defaultTextBox {
+        if err = v.Read(r, &v.defaultTextBox[i]); err != nil {
+            ol.E(nil, fmt.Sprintf("read tx3g default text box failed, err is %v", err))
+            return
+        }
+    }
+
+    // The default style record, 12 bytes.
+    v.Skip(r, uint64(12))
+
+    ol.I(nil, fmt.Sprintf("decode tx3g success, data:%+v", v))
+    return
+}
+
+/**
+ * WebVTT sample entry (wvtt), the vttC contains the header of WebVTT file.
+ * ISO_IEC_14496-30, WebVTT Sample Entry
+ * The sample is the vttc boxes for cues, each contains a payl for text, or a vtte for no cue.
+ */
+type Mp4WebVTTSampleEntry struct {
+    Mp4SampleEntry
+}
+
+func (v *Mp4WebVTTSampleEntry) vttC() (*Mp4WebVTTConfigBox, error) {
+    if box, err := v.get(SrsMp4BoxTypeVTTCONFIG); err != nil {
+        return nil, err
+    } else {
+        return box.(*Mp4WebVTTConfigBox), nil
+    }
+}
+
+type Mp4WebVTTConfigBox struct {
+    Mp4Box
+    config string
+}
+
+func (v *Mp4WebVTTConfigBox) Basic() *Mp4Box {
+    return &v.Mp4Box
+}
+
+func (v *Mp4WebVTTConfigBox) DecodeHeader(r io.Reader) (err error) {
+    data := make([]uint8, v.left())
+    if err = v.Read(r, data); err != nil {
+        ol.E(nil, fmt.Sprintf("read vttC config failed, err is %v", err))
+        return
+    }
+    v.config = string(data)
+
+    ol.I(nil, fmt.Sprintf("decode vttC success, config=%v", v.config))
+    return
+}
+
+func (v *Mp4AudioSampleEntry) esds() (*Mp4EsdsBox, error) {
+    if box, err := v.get(SrsMp4BoxTypeESDS); err != nil {
+        return nil, err
     } else {
         return box.(*Mp4EsdsBox), nil
     }
@@ -1445,6 +2473,338 @@ func (v *Mp4AudioSampleEntry) asc() (*Mp4DecoderSpecificInfo, error) {
     }
 }
 
+func (v *Mp4AudioSampleEntry) dOps() (*Mp4OpusSpecificBox, error) {
+    if box, err := v.get(SrsMp4BoxTypeDOPS); err != nil {
+        return nil, err
+    } else {
+        return box.(*Mp4OpusSpecificBox), nil
+    }
+}
+
+func (v *Mp4AudioSampleEntry) dfLa() (*Mp4FlacSpecificBox, error) {
+    if box, err := v.get(SrsMp4BoxTypeDFLA); err != nil {
+        return nil, err
+    } else {
+        return box.(*Mp4FlacSpecificBox), nil
+    }
+}
+
+func (v *Mp4AudioSampleEntry) dac3() (*Mp4AC3SpecificBox, error) {
+    if box, err := v.get(SrsMp4BoxTypeDAC3); err != nil {
+        return nil, err
+    } else {
+        return box.(*Mp4AC3SpecificBox), nil
+    }
+}
+
+func (v *Mp4AudioSampleEntry) dec3() (*Mp4EC3SpecificBox, error) {
+    if box, err := v.get(SrsMp4BoxTypeDEC3); err != nil {
+        return nil, err
+    } else {
+        return box.(*Mp4EC3SpecificBox), nil
+    }
+}
+
+/**
+ * 4.3.2 Opus Specific Box (dOps)
+ * Encapsulation of Opus in ISO Base Media File Format, version 0.6.8
+ * @see https://opus-codec.org/docs/opus_in_isobmff.html
+ * The fields are the OpusHead of RFC 7845 in big-endian, without the magic signature.
+ */
+type Mp4OpusSpecificBox struct {
+    Mp4Box
+    version uint8
+    outputChannelCount uint8
+    preSkip uint16
+    inputSampleRate uint32
+    outputGain int16
+    channelMappingFamily uint8
+    // For channel mapping family is not zero.
+    streamCount uint8
+    coupledCount uint8
+    channelMapping []uint8
+}
+
+func (v *Mp4OpusSpecificBox) Basic() *Mp4Box {
+    return &v.Mp4Box
+}
+
+func (v *Mp4OpusSpecificBox) DecodeHeader(r io.Reader) (err error) {
+    if v.left() < 11 {
+        err = fmt.Errorf("MP4 illegal dOps, size=%v", v.left())
+        ol.E(nil, err.Error())
+        return
+    }
+
+    for _, field := range []interface{}{&v.version, &v.outputChannelCount, &v.preSkip, &v.inputSampleRate,
+        &v.outputGain, &v.channelMappingFamily} {
+        if err = v.Read(r, field); err != nil {
+            ol.E(nil, fmt.Sprintf("read dOps failed, err is %v", err))
+            return
+        }
+    }
+
+    if v.channelMappingFamily != 0 {
+        if err = v.Read(r, &v.streamCount); err != nil {
+            ol.E(nil, fmt.Sprintf("read dOps stream count failed, err is %v", err))
+            return
+        }
+        if err = v.Read(r, &v.coupledCount); err != nil {
+            ol.E(nil, fmt.Sprintf("read dOps coupled count failed, err is %v", err))
+            return
+        }
+        v.channelMapping = make([]uint8, v.outputChannelCount)
+        if err = v.Read(r, v.channelMapping); err != nil {
+            ol.E(nil, fmt.Sprintf("read dOps channel mapping failed, err is %v", err))
+            return
+        }
+    }
+
+    ol.T(nil, fmt.Sprintf("read dOps box success, channels=%v, pre skip=%v, rate=%v, family=%v",
+        v.outputChannelCount, v.preSkip, v.inputSampleRate, v.channelMappingFamily))
+    return
+}
+
+/**
+ * Build the OpusHead for the sequence header, which is in little-endian and version 1.
+ * @see 5.1 Identification Header, RFC 7845
+ */
+func (v *Mp4OpusSpecificBox) opusHead() (head []byte) {
+    head = append(head, []byte("OpusHead")...)
+    head = append(head, 1, v.outputChannelCount)
+    head = append(head, uint8(v.preSkip), uint8(v.preSkip >> 8))
+    head = append(head, uint8(v.inputSampleRate), uint8(v.inputSampleRate >> 8),
+        uint8(v.inputSampleRate >> 16), uint8(v.inputSampleRate >> 24))
+    head = append(head, uint8(v.outputGain), uint8(v.outputGain >> 8))
+    head = append(head, v.channelMappingFamily)
+    if v.channelMappingFamily != 0 {
+        head = append(head, v.streamCount, v.coupledCount)
+        head = append(head, v.channelMapping...)
+    }
+    return
+}
+
+/**
+ * 3.3.2 FLAC Specific Box (dfLa)
+ * Encapsulation of FLAC in ISO Base Media File Format, version 0.0.4
+ * @see https://github.com/xiph/flac/blob/master/doc/isoflac.txt
+ * The metadata blocks of FLAC, the first is the STREAMINFO.
+ */
+type Mp4FlacSpecificBox struct {
+    Mp4FullBox
+    // The metadata blocks, with the block headers.
+    blocks []uint8
+    // Parsed from the STREAMINFO.
+    sampleRate uint32
+    channels uint8
+    bitsPerSample uint8
+}
+
+func (v *Mp4FlacSpecificBox) Basic() *Mp4Box {
+    return &v.Mp4FullBox.Mp4Box
+}
+
+func (v *Mp4FlacSpecificBox) NbHeader() int {
+    return v.Mp4FullBox.NbHeader()
+}
+
+func (v *Mp4FlacSpecificBox) DecodeHeader(r io.Reader) (err error) {
+    if err = v.Mp4FullBox.DecodeHeader(r); err != nil {
+        return
+    }
+
+    v.blocks = make([]uint8, v.left())
+    if err = v.Read(r, v.blocks); err != nil {
+        ol.E(nil, fmt.Sprintf("read dfLa blocks failed, err is %v", err))
+        return
+    }
+
+    // The STREAMINFO is 4 bytes header and 34 bytes data, where the sample rate is 20 bits,
+    // the channels minus one is 3 bits and the bits per sample minus one is 5 bits.
+    p := v.blocks
+    if len(p) < 4 + 34 || p[0] & 0x7f != SrsFlacMetadataTypeStreamInfo {
+        err = fmt.Errorf("MP4 illegal dfLa, no STREAMINFO, size=%v", len(p))
+        ol.E(nil, err.Error())
+        return
+    }
+    p = p[4 + 10:]
+    v.sampleRate = uint32(p[0]) << 12 | uint32(p[1]) << 4 | uint32(p[2]) >> 4
+    v.channels = (p[2] >> 1) & 0x07 + 1
+    v.bitsPerSample = (p[2] & 0x01) << 4 | p[3] >> 4 + 1
+
+    ol.T(nil, fmt.Sprintf("read dfLa box success, rate=%v, channels=%v, bits=%v", v.sampleRate, v.channels, v.bitsPerSample))
+    return
+}
+
+// Build the FLAC header for the sequence header, the fLaC marker and the metadata blocks.
+func (v *Mp4FlacSpecificBox) flacHeader() (header []byte) {
+    header = append(header, []byte("fLaC")...)
+    header = append(header, v.blocks...)
+    return
+}
+
+/**
+ * F.4 AC3SpecificBox (dac3)
+ * ETSI TS 102 366 V1.4.1, page 197
+ */
+type Mp4AC3SpecificBox struct {
+    Mp4Box
+    fscod uint8 // bit(2)
+    bsid uint8 // bit(5)
+    bsmod uint8 // bit(3)
+    acmod uint8 // bit(3)
+    lfeon uint8 // bit(1)
+    bitRateCode uint8 // bit(5)
+}
+
+func (v *Mp4AC3SpecificBox) Basic() *Mp4Box {
+    return &v.Mp4Box
+}
+
+func (v *Mp4AC3SpecificBox) DecodeHeader(r io.Reader) (err error) {
+    p := make([]uint8, 3)
+    if err = v.Read(r, p); err != nil {
+        ol.E(nil, fmt.Sprintf("read dac3 failed, err is %v", err))
+        return
+    }
+
+    v.fscod = (p[0] >> 6) & 0x03
+    v.bsid = (p[0] >> 1) & 0x1f
+    v.bsmod = (p[0] & 0x01) << 2 | (p[1] >> 6) & 0x03
+    v.acmod = (p[1] >> 3) & 0x07
+    v.lfeon = (p[1] >> 2) & 0x01
+    v.bitRateCode = (p[1] & 0x03) << 3 | (p[2] >> 5) & 0x07
+
+    ol.T(nil, fmt.Sprintf("read dac3 box success, fscod=%v, acmod=%v, lfeon=%v", v.fscod, v.acmod, v.lfeon))
+    return
+}
+
+func (v *Mp4AC3SpecificBox) sampleRate() uint32 {
+    return ac3SampleRate(v.fscod)
+}
+
+func (v *Mp4AC3SpecificBox) channels() int {
+    return SrsAc3Channels[v.acmod] + int(v.lfeon)
+}
+
+/**
+ * F.6 EC3SpecificBox (dec3)
+ * ETSI TS 102 366 V1.4.1, page 199
+ */
+type Mp4EC3SpecificBox struct {
+    Mp4Box
+    dataRate uint16 // bit(13)
+    // The independent substreams, the numIndSub plus one.
+    substreams []*Mp4EC3Substream
+}
+
+type Mp4EC3Substream struct {
+    fscod uint8 // bit(2)
+    bsid uint8 // bit(5)
+    asvc uint8 // bit(1)
+    bsmod uint8 // bit(3)
+    acmod uint8 // bit(3)
+    lfeon uint8 // bit(1)
+    numDepSub uint8 // bit(4)
+    // The channel locations of dependent substreams, when numDepSub is not zero.
+    chanLoc uint16 // bit(9)
+}
+
+func (v *Mp4EC3SpecificBox) Basic() *Mp4Box {
+    return &v.Mp4Box
+}
+
+func (v *Mp4EC3SpecificBox) DecodeHeader(r io.Reader) (err error) {
+    p := make([]uint8, v.left())
+    if err = v.Read(r, p); err != nil {
+        ol.E(nil, fmt.Sprintf("read dec3 failed, err is %v", err))
+        return
+    }
+
+    b := NewBitBuffer(p)
+    var dataRate, numIndSub uint32
+    if dataRate, err = b.readBits(13); err != nil {
+        ol.E(nil, fmt.Sprintf("read dec3 data rate failed, err is %v", err))
+        return
+    }
+    if numIndSub, err = b.readBits(3); err != nil {
+        ol.E(nil, fmt.Sprintf("read dec3 num ind sub failed, err is %v", err))
+        return
+    }
+    v.dataRate = uint16(dataRate)
+
+    for i := 0; i <= int(numIndSub); i++ {
+        // The fields in bits, where the zero size is the reserved bits.
+        sub := &Mp4EC3Substream{}
+        fields := []struct {
+            n int
+            value *uint8
+        }{{2, &sub.fscod}, {5, &sub.bsid}, {1, nil}, {1, &sub.asvc}, {3, &sub.bsmod}, {3, &sub.acmod},
+            {1, &sub.lfeon}, {3, nil}, {4, &sub.numDepSub}}
+        for _, field := range fields {
+            var value uint32
+            if value, err = b.readBits(field.n); err != nil {
+                ol.E(nil, fmt.Sprintf("read dec3 substream %v failed, err is %v", i, err))
+                return
+            }
+            if field.value != nil {
+                *field.value = uint8(value)
+            }
+        }
+
+        var chanLoc uint32
+        if sub.numDepSub > 0 {
+            chanLoc, err = b.readBits(9)
+        } else {
+            err = b.skipBits(1)
+        }
+        if err != nil {
+            ol.E(nil, fmt.Sprintf("read dec3 substream %v chan loc failed, err is %v", i, err))
+            return
+        }
+        sub.chanLoc = uint16(chanLoc)
+
+        v.substreams = append(v.substreams, sub)
+    }
+
+    ol.T(nil, fmt.Sprintf("read dec3 box success, data rate=%v, substreams=%v", v.dataRate, len(v.substreams)))
+    return
+}
+
+// The sample rate of the first independent substream.
+func (v *Mp4EC3SpecificBox) sampleRate() uint32 {
+    if len(v.substreams) == 0 {
+        return 0
+    }
+    return ac3SampleRate(v.substreams[0].fscod)
+}
+
+// The channels of the first independent substream, with its dependent substreams.
+// @see Table F.6.1 chan_loc field bit assignments, ETSI TS 102 366 V1.4.1, page 200
+func (v *Mp4EC3SpecificBox) channels() (channels int) {
+    if len(v.substreams) == 0 {
+        return 0
+    }
+
+    sub := v.substreams[0]
+    channels = SrsAc3Channels[sub.acmod] + int(sub.lfeon)
+    // From the MSB, the Lc/Rc, Lrs/Rrs, Cs, Ts, Lsd/Rsd, Lw/Rw, Lvh/Rvh, Cvh and LFE2.
+    for i, n := range []int{2, 2, 1, 1, 2, 2, 2, 1, 1} {
+        if (sub.chanLoc >> uint(8 - i)) & 0x01 == 1 {
+            channels += n
+        }
+    }
+    return
+}
+
+// The sample rate of fscod, 0 for reserved.
+func ac3SampleRate(fscod uint8) uint32 {
+    if int(fscod) < len(SrsAc3SampleRates) {
+        return SrsAc3SampleRates[fscod]
+    }
+    return 0
+}
+
 /**
  * 7.2.2.2 BaseDescriptor
  * ISO_IEC_14496-1-System-2010.pdf, page 32
@@ -1763,6 +3123,11 @@ func (v *Mp4EsdsBox) asc() (*Mp4DecoderSpecificInfo, error) {
     return v.es.decConfigDescr.descSpecificInfo, nil
 }
 
+// Get the objectTypeIndication, for example, 0x40 for AAC.
+func (v *Mp4EsdsBox) objectType() uint8 {
+    return v.es.decConfigDescr.objectTypeIndication
+}
+
 /**
  * 8.5.2 Sample Description Box (stsd), for Audio/Video.
  * ISO_IEC_14496-12-base-format-2012.pdf, page 40
@@ -2017,11 +3382,17 @@ func (v *Mp4CompositionTime2SampleBox) DecodeHeader(r io.Reader) (err error) {
         }
         if v.Version == 0 {
             var offset uint32
-            v.Read(r, &offset)
+            if err = v.Read(r, &offset); err != nil {
+                ol.E(nil, fmt.Sprintf("read ctts entry sample offset failed, err is %v", err))
+                return
+            }
             entry.sampleOffset = int64(offset)
         } else if v.Version == 1 {
             var offset int32
-            v.Read(r, &offset)
+            if err = v.Read(r, &offset); err != nil {
+                ol.E(nil, fmt.Sprintf("read ctts entry sample offset failed, err is %v", err))
+                return
+            }
             entry.sampleOffset = int64(offset)
         }
         ol.I(nil, fmt.Sprintf("decode one ctts entry, entry=%+v", entry))
@@ -2194,6 +3565,17 @@ func (v *Mp4Sample2ChunkBox) Basic() *Mp4Box {
     return &v.Mp4Box
 }
 
+/**
+ * 8.7.3 Sample Size Boxes, the stsz or stz2.
+ * ISO_IEC_14496-12-base-format-2012.pdf, page 57
+ */
+type Mp4SampleSizeTable interface {
+    // Get the size in bytes of sample at index, start from 0.
+    getSampleSize(index uint32) (size uint32, err error)
+    // Get the number of samples in the track.
+    getSampleCount() uint32
+}
+
 /**
  * 8.7.3.2 Sample Size Box (stsz), for Audio/Video.
  * ISO_IEC_14496-12-base-format-2012.pdf, page 58
@@ -2236,6 +3618,10 @@ func (v *Mp4SampleSizeBox) getSampleSize(index uint32) (size uint32, err error)
     return
 }
 
+func (v *Mp4SampleSizeBox) getSampleCount() uint32 {
+    return v.sampleCount
+}
+
 func (v *Mp4SampleSizeBox) DecodeHeader(r io.Reader) (err error) {
     if err = v.Mp4FullBox.DecodeHeader(r); err != nil {
         return
@@ -2271,8 +3657,108 @@ func (v *Mp4SampleSizeBox) Basic() *Mp4Box {
 }
 
 /**
- * 8.7.5 Chunk Offset Box (stco), for Audio/Video.
- * ISO_IEC_14496-12-base-format-2012.pdf, page 59
+ * 8.7.3.3 Compact Sample Size Box (stz2), for Audio/Video.
+ * ISO_IEC_14496-12-base-format-2012.pdf, page 58
+ * This box is a compact version of stsz, the sample sizes are stored in 4, 8 or 16 bits fields,
+ * where two 4 bits sizes are packed in one byte, the first in the upper nibble.
+ */
+type Mp4CompactSampleSizeBox struct {
+    Mp4FullBox
+    // an integer specifying the size in bits of the entries in the following table; it shall
+    // take the value 4, 8 or 16.
+    fieldSize   uint8
+    // an integer that gives the number of entries in the following table.
+    sampleCount uint32
+    // each entry_size is an integer specifying the size of a sample, indexed by its number.
+    entrySizes  []uint32
+}
+
+func NewMp4CompactSampleSizeBox() *Mp4CompactSampleSizeBox {
+    v := &Mp4CompactSampleSizeBox{
+        entrySizes: []uint32{},
+    }
+    return v
+}
+
+func (v *Mp4CompactSampleSizeBox) getSampleSize(index uint32) (size uint32, err error) {
+    if index >= v.sampleCount {
+        err = fmt.Errorf("MP4 stz2 overflow, sample_count=%v, req index=%v", v.sampleCount, index)
+        return
+    }
+
+    size = v.entrySizes[index]
+    return
+}
+
+func (v *Mp4CompactSampleSizeBox) getSampleCount() uint32 {
+    return v.sampleCount
+}
+
+func (v *Mp4CompactSampleSizeBox) DecodeHeader(r io.Reader) (err error) {
+    if err = v.Mp4FullBox.DecodeHeader(r); err != nil {
+        return
+    }
+
+    v.Skip(r, uint64(3))
+
+    if err = v.Read(r, &v.fieldSize); err != nil {
+        ol.E(nil, fmt.Sprintf("read stz2 field size failed, err is %v", err))
+        return
+    }
+
+    if err = v.Read(r, &v.sampleCount); err != nil {
+        ol.E(nil, fmt.Sprintf("read stz2 sample count failed, err is %v", err))
+        return
+    }
+
+    switch v.fieldSize {
+    case 4:
+        for i := 0; i < int(v.sampleCount); i += 2 {
+            var sizes uint8
+            if err = v.Read(r, &sizes); err != nil {
+                ol.E(nil, fmt.Sprintf("read stz2 %v entry size failed, err is %v", i, err))
+                return
+            }
+            v.entrySizes = append(v.entrySizes, uint32(sizes >> 4))
+            if i + 1 < int(v.sampleCount) {
+                v.entrySizes = append(v.entrySizes, uint32(sizes & 0x0f))
+            }
+        }
+    case 8:
+        for i := 0; i < int(v.sampleCount); i++ {
+            var size uint8
+            if err = v.Read(r, &size); err != nil {
+                ol.E(nil, fmt.Sprintf("read stz2 %v entry size failed, err is %v", i, err))
+                return
+            }
+            v.entrySizes = append(v.entrySizes, uint32(size))
+        }
+    case 16:
+        for i := 0; i < int(v.sampleCount); i++ {
+            var size uint16
+            if err = v.Read(r, &size); err != nil {
+                ol.E(nil, fmt.Sprintf("read stz2 %v entry size failed, err is %v", i, err))
+                return
+            }
+            v.entrySizes = append(v.entrySizes, uint32(size))
+        }
+    default:
+        err = fmt.Errorf("MP4 illegal stz2 field size=%v", v.fieldSize)
+        ol.E(nil, err.Error())
+        return
+    }
+
+    ol.I(nil, fmt.Sprintf("decode stz2 box success, box=%+v", v))
+    return
+}
+
+func (v *Mp4CompactSampleSizeBox) Basic() *Mp4Box {
+    return &v.Mp4Box
+}
+
+/**
+ * 8.7.5 Chunk Offset Box (stco), for Audio/Video.
+ * ISO_IEC_14496-12-base-format-2012.pdf, page 59
  * The chunk offset table gives the index of each chunk into the containing file. There are two variants, permitting
  * the use of 32-bit or 64-bit offsets. The latter is useful when managing very large presentations. At most one of
  * these variants will occur in any single instance of a sample table.
@@ -2320,6 +3806,439 @@ func (v *Mp4ChunkOffsetBox) Basic() *Mp4Box {
     return &v.Mp4Box
 }
 
+/**
+ * 8.7.5 Chunk Large Offset Box (co64), for Audio/Video.
+ * ISO_IEC_14496-12-base-format-2012.pdf, page 59
+ * The 64-bit variant of the chunk offset table, used when the media data is beyond 4GB.
+ */
+type Mp4ChunkLargeOffsetBox struct {
+    Mp4FullBox
+    // an integer that gives the number of entries in the following table
+    EntryCount uint32
+    // a 64 bit integer that gives the offset of the start of a chunk into its containing
+    // media file.
+    Entries []uint64
+}
+
+func NewMp4ChunkLargeOffsetBox() *Mp4ChunkLargeOffsetBox {
+    v := &Mp4ChunkLargeOffsetBox{
+        Entries: []uint64{},
+    }
+    return v
+}
+
+func (v *Mp4ChunkLargeOffsetBox) DecodeHeader(r io.Reader) (err error) {
+    if err = v.Mp4FullBox.DecodeHeader(r); err != nil {
+        return
+    }
+
+    if err = v.Read(r, &v.EntryCount); err != nil {
+        ol.E(nil, fmt.Sprintf("read co64 entry count failed, err is %v", err))
+        return
+    }
+
+    for i := 0; i < int(v.EntryCount); i++ {
+        var entry uint64
+        if err = v.Read(r, &entry); err != nil {
+            ol.E(nil, fmt.Sprintf("read co64 %v entry failed, err is %v", i, err))
+            return
+        }
+        v.Entries = append(v.Entries, entry)
+    }
+
+    ol.I(nil, fmt.Sprintf("decode co64 box success, box=%+v", v))
+    return
+}
+
+func (v *Mp4ChunkLargeOffsetBox) Basic() *Mp4Box {
+    return &v.Mp4Box
+}
+
+/**
+ * 8.8.1 Movie Extends Box (mvex)
+ * ISO_IEC_14496-12-base-format-2012.pdf, page 64
+ * This box warns readers that there might be Movie Fragment Boxes in this file.
+ */
+type Mp4MovieExtendsBox struct {
+    Mp4Box
+}
+
+func (v *Mp4MovieExtendsBox) Basic() *Mp4Box {
+    return &v.Mp4Box
+}
+
+// Get the trex of track, which sets up the default values used by the movie fragments.
+func (v *Mp4MovieExtendsBox) trex(trackId uint32) (*Mp4TrackExtendsBox, error) {
+    for _, box := range v.Boxes {
+        if trex, ok := box.(*Mp4TrackExtendsBox); ok && trex.trackId == trackId {
+            return trex, nil
+        }
+    }
+    return nil, fmt.Errorf("can't find trex of track %v in mvex", trackId)
+}
+
+/**
+ * 8.8.3 Track Extends Box (trex)
+ * ISO_IEC_14496-12-base-format-2012.pdf, page 65
+ * This sets up default values used by the movie fragments. By setting defaults in this way, space and
+ * complexity can be saved in each Track Fragment Box.
+ */
+type Mp4TrackExtendsBox struct {
+    Mp4FullBox
+    // identifies the track; this shall be the track ID of a track in the Movie Box
+    trackId uint32
+    // these fields set up defaults used in the track fragments.
+    defaultSampleDescriptionIndex uint32
+    defaultSampleDuration uint32
+    defaultSampleSize uint32
+    defaultSampleFlags uint32
+}
+
+func (v *Mp4TrackExtendsBox) Basic() *Mp4Box {
+    return &v.Mp4Box
+}
+
+func (v *Mp4TrackExtendsBox) DecodeHeader(r io.Reader) (err error) {
+    if err = v.Mp4FullBox.DecodeHeader(r); err != nil {
+        return
+    }
+
+    if err = v.Read(r, &v.trackId); err != nil {
+        ol.E(nil, fmt.Sprintf("read trex track id failed, err is %v", err))
+        return
+    }
+
+    if err = v.Read(r, &v.defaultSampleDescriptionIndex); err != nil {
+        ol.E(nil, fmt.Sprintf("read trex default sample description index failed, err is %v", err))
+        return
+    }
+
+    if err = v.Read(r, &v.defaultSampleDuration); err != nil {
+        ol.E(nil, fmt.Sprintf("read trex default sample duration failed, err is %v", err))
+        return
+    }
+
+    if err = v.Read(r, &v.defaultSampleSize); err != nil {
+        ol.E(nil, fmt.Sprintf("read trex default sample size failed, err is %v", err))
+        return
+    }
+
+    if err = v.Read(r, &v.defaultSampleFlags); err != nil {
+        ol.E(nil, fmt.Sprintf("read trex default sample flags failed, err is %v", err))
+        return
+    }
+
+    ol.I(nil, fmt.Sprintf("decode trex box success, box=%+v", v))
+    return
+}
+
+/**
+ * 8.8.4 Movie Fragment Box (moof)
+ * ISO_IEC_14496-12-base-format-2012.pdf, page 66
+ * The movie fragments extend the presentation in time. They provide the information that would previously have
+ * been in the Movie Box.
+ */
+type Mp4MovieFragmentBox struct {
+    Mp4Box
+}
+
+func (v *Mp4MovieFragmentBox) Basic() *Mp4Box {
+    return &v.Mp4Box
+}
+
+/**
+ * 8.8.5 Movie Fragment Header Box (mfhd)
+ * ISO_IEC_14496-12-base-format-2012.pdf, page 67
+ */
+type Mp4MovieFragmentHeaderBox struct {
+    Mp4FullBox
+    // the ordinal number of this fragment, in increasing order
+    sequenceNumber uint32
+}
+
+func (v *Mp4MovieFragmentHeaderBox) Basic() *Mp4Box {
+    return &v.Mp4Box
+}
+
+func (v *Mp4MovieFragmentHeaderBox) DecodeHeader(r io.Reader) (err error) {
+    if err = v.Mp4FullBox.DecodeHeader(r); err != nil {
+        return
+    }
+
+    if err = v.Read(r, &v.sequenceNumber); err != nil {
+        ol.E(nil, fmt.Sprintf("read mfhd sequence number failed, err is %v", err))
+        return
+    }
+
+    ol.I(nil, fmt.Sprintf("decode mfhd box success, box=%+v", v))
+    return
+}
+
+/**
+ * 8.8.6 Track Fragment Box (traf)
+ * ISO_IEC_14496-12-base-format-2012.pdf, page 67
+ * Within the movie fragment there is a set of track fragments, zero or more per track.
+ */
+type Mp4TrackFragmentBox struct {
+    Mp4Box
+}
+
+func (v *Mp4TrackFragmentBox) Basic() *Mp4Box {
+    return &v.Mp4Box
+}
+
+func (v *Mp4TrackFragmentBox) tfhd() (*Mp4TrackFragmentHeaderBox, error) {
+    if box, err := v.get(SrsMp4BoxTypeTFHD); err != nil {
+        return nil, err
+    } else {
+        return box.(*Mp4TrackFragmentHeaderBox), nil
+    }
+}
+
+func (v *Mp4TrackFragmentBox) tfdt() (*Mp4TrackFragmentDecodeTimeBox, error) {
+    if box, err := v.get(SrsMp4BoxTypeTFDT); err != nil {
+        return nil, err
+    } else {
+        return box.(*Mp4TrackFragmentDecodeTimeBox), nil
+    }
+}
+
+// Get all the track runs, there maybe zero or more trun in traf.
+func (v *Mp4TrackFragmentBox) truns() (truns []*Mp4TrackFragmentRunBox) {
+    for _, box := range v.Boxes {
+        if trun, ok := box.(*Mp4TrackFragmentRunBox); ok {
+            truns = append(truns, trun)
+        }
+    }
+    return
+}
+
+/**
+ * 8.8.7 Track Fragment Header Box (tfhd)
+ * ISO_IEC_14496-12-base-format-2012.pdf, page 68
+ * Each movie fragment can add zero or more fragments to each track; and a track fragment can add zero or
+ * more contiguous runs of samples. The track fragment header sets up information and defaults used for those
+ * runs of samples.
+ */
+type Mp4TrackFragmentHeaderBox struct {
+    Mp4FullBox
+    trackId uint32
+    // all the following are optional fields, see SrsMp4TfhdFlags.
+    baseDataOffset uint64
+    sampleDescriptionIndex uint32
+    defaultSampleDuration uint32
+    defaultSampleSize uint32
+    defaultSampleFlags uint32
+}
+
+func (v *Mp4TrackFragmentHeaderBox) Basic() *Mp4Box {
+    return &v.Mp4Box
+}
+
+func (v *Mp4TrackFragmentHeaderBox) DecodeHeader(r io.Reader) (err error) {
+    if err = v.Mp4FullBox.DecodeHeader(r); err != nil {
+        return
+    }
+
+    if err = v.Read(r, &v.trackId); err != nil {
+        ol.E(nil, fmt.Sprintf("read tfhd track id failed, err is %v", err))
+        return
+    }
+
+    if (v.Flags & SrsMp4TfhdFlagsBaseDataOffset) != 0 {
+        if err = v.Read(r, &v.baseDataOffset); err != nil {
+            ol.E(nil, fmt.Sprintf("read tfhd base data offset failed, err is %v", err))
+            return
+        }
+    }
+
+    if (v.Flags & SrsMp4TfhdFlagsSampleDescriptionIndex) != 0 {
+        if err = v.Read(r, &v.sampleDescriptionIndex); err != nil {
+            ol.E(nil, fmt.Sprintf("read tfhd sample description index failed, err is %v", err))
+            return
+        }
+    }
+
+    if (v.Flags & SrsMp4TfhdFlagsDefaultSampleDuration) != 0 {
+        if err = v.Read(r, &v.defaultSampleDuration); err != nil {
+            ol.E(nil, fmt.Sprintf("read tfhd default sample duration failed, err is %v", err))
+            return
+        }
+    }
+
+    if (v.Flags & SrsMp4TfhdFlagsDefaultSampleSize) != 0 {
+        if err = v.Read(r, &v.defaultSampleSize); err != nil {
+            ol.E(nil, fmt.Sprintf("read tfhd default sample size failed, err is %v", err))
+            return
+        }
+    }
+
+    if (v.Flags & SrsMp4TfhdFlagsDefaultSampleFlags) != 0 {
+        if err = v.Read(r, &v.defaultSampleFlags); err != nil {
+            ol.E(nil, fmt.Sprintf("read tfhd default sample flags failed, err is %v", err))
+            return
+        }
+    }
+
+    ol.I(nil, fmt.Sprintf("decode tfhd box success, box=%+v", v))
+    return
+}
+
+/**
+ * 8.8.12 Track fragment decode time (tfdt)
+ * ISO_IEC_14496-12-base-format-2012.pdf, page 72
+ * The Track Fragment Base Media Decode Time Box provides the absolute decode time, measured on the media
+ * timeline, of the first sample in decode order in the track fragment.
+ */
+type Mp4TrackFragmentDecodeTimeBox struct {
+    Mp4FullBox
+    baseMediaDecodeTime uint64
+}
+
+func (v *Mp4TrackFragmentDecodeTimeBox) Basic() *Mp4Box {
+    return &v.Mp4Box
+}
+
+func (v *Mp4TrackFragmentDecodeTimeBox) DecodeHeader(r io.Reader) (err error) {
+    if err = v.Mp4FullBox.DecodeHeader(r); err != nil {
+        return
+    }
+
+    if v.Version == 1 {
+        if err = v.Read(r, &v.baseMediaDecodeTime); err != nil {
+            ol.E(nil, fmt.Sprintf("read tfdt base media decode time failed, err is %v", err))
+            return
+        }
+    } else {
+        var tmp uint32
+        if err = v.Read(r, &tmp); err != nil {
+            ol.E(nil, fmt.Sprintf("read tfdt base media decode time failed, err is %v", err))
+            return
+        }
+        v.baseMediaDecodeTime = uint64(tmp)
+    }
+
+    ol.I(nil, fmt.Sprintf("decode tfdt box success, box=%+v", v))
+    return
+}
+
+/**
+ * 8.8.8 Track Fragment Run Box (trun)
+ * ISO_IEC_14496-12-base-format-2012.pdf, page 69
+ */
+type Mp4TrunEntry struct {
+    // all the following are optional fields, see SrsMp4TrunFlags.
+    sampleDuration uint32
+    sampleSize uint32
+    sampleFlags uint32
+    // uint32_t for version=0
+    // int32_t for version=1
+    sampleCompositionTimeOffset int64
+}
+
+/**
+ * 8.8.8 Track Fragment Run Box (trun)
+ * ISO_IEC_14496-12-base-format-2012.pdf, page 69
+ * Within the Track Fragment Box, there are zero or more Track Run Boxes. If the duration-is-empty flag is set in
+ * the tf_flags, there are no track runs. A track run documents a contiguous set of samples for a track.
+ */
+type Mp4TrackFragmentRunBox struct {
+    Mp4FullBox
+    // the number of samples being added in this run; also the number of rows in the following
+    // table (the rows can be empty)
+    sampleCount uint32
+    // the following are optional fields, see SrsMp4TrunFlags.
+    // is added to the implicit or explicit data_offset established in the track fragment header.
+    dataOffset int32
+    // provides a set of flags for the first sample only of this run.
+    firstSampleFlags uint32
+    entries []*Mp4TrunEntry
+}
+
+func NewMp4TrackFragmentRunBox() *Mp4TrackFragmentRunBox {
+    v := &Mp4TrackFragmentRunBox{
+        entries: []*Mp4TrunEntry{},
+    }
+    return v
+}
+
+func (v *Mp4TrackFragmentRunBox) Basic() *Mp4Box {
+    return &v.Mp4Box
+}
+
+func (v *Mp4TrackFragmentRunBox) DecodeHeader(r io.Reader) (err error) {
+    if err = v.Mp4FullBox.DecodeHeader(r); err != nil {
+        return
+    }
+
+    if err = v.Read(r, &v.sampleCount); err != nil {
+        ol.E(nil, fmt.Sprintf("read trun sample count failed, err is %v", err))
+        return
+    }
+
+    if (v.Flags & SrsMp4TrunFlagsDataOffset) != 0 {
+        if err = v.Read(r, &v.dataOffset); err != nil {
+            ol.E(nil, fmt.Sprintf("read trun data offset failed, err is %v", err))
+            return
+        }
+    }
+
+    if (v.Flags & SrsMp4TrunFlagsFirstSampleFlags) != 0 {
+        if err = v.Read(r, &v.firstSampleFlags); err != nil {
+            ol.E(nil, fmt.Sprintf("read trun first sample flags failed, err is %v", err))
+            return
+        }
+    }
+
+    for i := 0; i < int(v.sampleCount); i++ {
+        entry := &Mp4TrunEntry{}
+
+        if (v.Flags & SrsMp4TrunFlagsSampleDuration) != 0 {
+            if err = v.Read(r, &entry.sampleDuration); err != nil {
+                ol.E(nil, fmt.Sprintf("read trun %v sample duration failed, err is %v", i, err))
+                return
+            }
+        }
+
+        if (v.Flags & SrsMp4TrunFlagsSampleSize) != 0 {
+            if err = v.Read(r, &entry.sampleSize); err != nil {
+                ol.E(nil, fmt.Sprintf("read trun %v sample size failed, err is %v", i, err))
+                return
+            }
+        }
+
+        if (v.Flags & SrsMp4TrunFlagsSampleFlags) != 0 {
+            if err = v.Read(r, &entry.sampleFlags); err != nil {
+                ol.E(nil, fmt.Sprintf("read trun %v sample flags failed, err is %v", i, err))
+                return
+            }
+        }
+
+        if (v.Flags & SrsMp4TrunFlagsSampleCtsOffset) != 0 {
+            if v.Version == 0 {
+                var offset uint32
+                if err = v.Read(r, &offset); err != nil {
+                    ol.E(nil, fmt.Sprintf("read trun %v sample cts offset failed, err is %v", i, err))
+                    return
+                }
+                entry.sampleCompositionTimeOffset = int64(offset)
+            } else {
+                var offset int32
+                if err = v.Read(r, &offset); err != nil {
+                    ol.E(nil, fmt.Sprintf("read trun %v sample cts offset failed, err is %v", i, err))
+                    return
+                }
+                entry.sampleCompositionTimeOffset = int64(offset)
+            }
+        }
+
+        v.entries = append(v.entries, entry)
+    }
+
+    ol.I(nil, fmt.Sprintf("decode trun box success, sample count=%v", v.sampleCount))
+    return
+}
+
 /**
  * 8.10.1 User Data Box (udta)
  * ISO_IEC_14496-12-base-format-2012.pdf, page 78
@@ -2341,7 +4260,17 @@ func NewMp4UserDataBox() *Mp4UserDataBox {
 
 func (v *Mp4UserDataBox) DecodeHeader(r io.Reader) (err error) {
     v.NbData = int(v.left())
-    v.Skip(r, v.left())
+    v.Data = make([]uint8, v.NbData)
+    if err = v.Read(r, v.Data); err != nil {
+        ol.E(nil, fmt.Sprintf("read udta data failed, err is %v", err))
+        return
+    }
+
+    // The user data is optional, so ignore the error of contained boxes.
+    if err := v.decodeBoxesFrom(v.Data); err != nil {
+        ol.W(nil, fmt.Sprintf("ignore udta boxes, err is %v", err))
+    }
+
     ol.I(nil, fmt.Sprintf("decode udta box success, nb data=%v", v.NbData))
     return
 }
@@ -2350,6 +4279,286 @@ func (v *Mp4UserDataBox) Basic() *Mp4Box {
     return &v.Mp4Box
 }
 
+func (v *Mp4UserDataBox) meta() (*Mp4MetaBox, error) {
+    if box, err := v.get(SrsMp4BoxTypeMETA); err != nil {
+        return nil, err
+    } else {
+        return box.(*Mp4MetaBox), nil
+    }
+}
+
+func (v *Mp4UserDataBox) chpl() (*Mp4ChapterListBox, error) {
+    if box, err := v.get(SrsMp4BoxTypeCHPL); err != nil {
+        return nil, err
+    } else {
+        return box.(*Mp4ChapterListBox), nil
+    }
+}
+
+/**
+ * The Nero chapter list box (chpl) in udta, the start time of chapter is in 100 nanoseconds.
+ */
+type Mp4ChplEntry struct {
+    startTime uint64
+    title string
+}
+
+type Mp4ChapterListBox struct {
+    Mp4FullBox
+    entries []*Mp4ChplEntry
+}
+
+func (v *Mp4ChapterListBox) Basic() *Mp4Box {
+    return &v.Mp4FullBox.Mp4Box
+}
+
+func (v *Mp4ChapterListBox) NbHeader() int {
+    return v.Mp4FullBox.NbHeader()
+}
+
+func (v *Mp4ChapterListBox) DecodeHeader(r io.Reader) (err error) {
+    if err = v.Mp4FullBox.DecodeHeader(r); err != nil {
+        return
+    }
+
+    // The version 1 has 4 bytes reserved.
+    if v.Version == 1 {
+        v.Skip(r, uint64(4))
+    }
+
+    var count uint8
+    if err = v.Read(r, &count); err != nil {
+        ol.E(nil, fmt.Sprintf("read chpl count failed, err is %v", err))
+        return
+    }
+
+    for i := 0; i < int(count); i++ {
+        entry := &Mp4ChplEntry{}
+        if err = v.Read(r, &entry.startTime); err != nil {
+            ol.E(nil, fmt.Sprintf("read chpl start time failed, err is %v", err))
+            return
+        }
+
+        var size uint8
+        if err = v.Read(r, &size); err != nil {
+            ol.E(nil, fmt.Sprintf("read chpl title size failed, err is %v", err))
+            return
+        }
+        title := make([]uint8, size)
+        if err = v.Read(r, title); err != nil {
+            ol.E(nil, fmt.Sprintf("read chpl title failed, err is %v", err))
+            return
+        }
+        entry.title = string(title)
+
+        v.entries = append(v.entries, entry)
+    }
+    v.Skip(r, v.left())
+
+    ol.I(nil, fmt.Sprintf("decode chpl box success, chapters=%v", len(v.entries)))
+    return
+}
+
+/**
+ * 8.11.1 The Meta box (meta)
+ * ISO_IEC_14496-12-base-format-2012.pdf
+ * The handler of iTunes metadata is 'mdir', and the metadata is in the item list (ilst).
+ * @remark The QuickTime meta is not a full box, the hdlr follows the box header.
+ */
+type Mp4MetaBox struct {
+    Mp4FullBox
+}
+
+func (v *Mp4MetaBox) Basic() *Mp4Box {
+    return &v.Mp4FullBox.Mp4Box
+}
+
+func (v *Mp4MetaBox) NbHeader() int {
+    return v.Mp4FullBox.NbHeader()
+}
+
+func (v *Mp4MetaBox) DecodeHeader(r io.Reader) (err error) {
+    data := make([]uint8, v.left())
+    if err = v.Read(r, data); err != nil {
+        ol.E(nil, fmt.Sprintf("read meta data failed, err is %v", err))
+        return
+    }
+
+    // The metadata is optional, in udta, moov or trak, so ignore the malformed meta,
+    // keep the boxes decoded and skip the rest of box.
+    // For full box, the version and flags, then the contained boxes.
+    if len(data) < 8 || binary.BigEndian.Uint32(data[4:8]) != SrsMp4BoxTypeHDLR {
+        if len(data) < 4 {
+            ol.W(nil, fmt.Sprintf("ignore meta box, too small, size=%v", len(data)))
+            return
+        }
+        v.Flags = binary.BigEndian.Uint32(data[0:4])
+        v.Version = uint8((v.Flags >> 24) & 0xff)
+        v.Flags = v.Flags & 0x00ffffff
+        data = data[4:]
+    }
+
+    if err := v.decodeBoxesFrom(data); err != nil {
+        ol.W(nil, fmt.Sprintf("ignore meta boxes after %v boxes, err is %v", len(v.Boxes), err))
+    }
+
+    ol.I(nil, fmt.Sprintf("decode meta box success, boxes=%v", len(v.Boxes)))
+    return
+}
+
+func (v *Mp4MetaBox) ilst() (*Mp4ItemListBox, error) {
+    if box, err := v.get(SrsMp4BoxTypeILST); err != nil {
+        return nil, err
+    } else {
+        return box.(*Mp4ItemListBox), nil
+    }
+}
+
+/**
+ * The item of iTunes metadata, for example, the ©nam for title.
+ */
+type Mp4IlstItem struct {
+    // The type of item, for example, ©nam, or ---- for free-form.
+    itemType uint32
+    // For free-form item, the mean and name, for example, com.apple.iTunes and iTunSMPB.
+    mean string
+    name string
+    // The type of data atom, for example, 1 for UTF-8, 13 for JPEG.
+    dataType uint32
+    data []uint8
+}
+
+// Get the key of onMetaData, empty for the unknown item.
+func (v *Mp4IlstItem) key() string {
+    switch v.itemType {
+    case SrsMp4IlstTypeName:
+        return "title"
+    case SrsMp4IlstTypeArtist:
+        return "artist"
+    case SrsMp4IlstTypeAlbum:
+        return "album"
+    case SrsMp4IlstTypeDay:
+        return "date"
+    case SrsMp4IlstTypeTool:
+        return "encoder"
+    case SrsMp4IlstTypeDesc:
+        return "description"
+    case SrsMp4IlstTypeCover:
+        return "cover"
+    case SrsMp4IlstTypeFreeForm:
+        return v.name
+    }
+    return ""
+}
+
+// Get the value of onMetaData, string or number, nil for the binary such as cover.
+func (v *Mp4IlstItem) value() interface{} {
+    switch v.dataType {
+    case SrsMp4IlstDataTypeUTF8:
+        return string(v.data)
+    case SrsMp4IlstDataTypeSignedInt, SrsMp4IlstDataTypeUnsignedInt:
+        if len(v.data) == 0 || len(v.data) > 8 {
+            return nil
+        }
+        var n uint64
+        for _, b := range v.data {
+            n = n << 8 | uint64(b)
+        }
+        // Sign extend for the signed integer.
+        if v.dataType == SrsMp4IlstDataTypeSignedInt {
+            shift := uint(64 - 8 * len(v.data))
+            return float64(int64(n << shift) >> shift)
+        }
+        return float64(n)
+    }
+    return nil
+}
+
+func (v *Mp4IlstItem) String() string {
+    if v.itemType == SrsMp4IlstTypeFreeForm {
+        return fmt.Sprintf("%v:%v, type=%v, nb data=%v", v.mean, v.name, v.dataType, len(v.data))
+    }
+    return fmt.Sprintf("%v, type=%v, nb data=%v", fourCCString(v.itemType), v.dataType, len(v.data))
+}
+
+/**
+ * The iTunes metadata item list (ilst), each item is an atom of the item type which contains a data atom.
+ * The data atom is the type indicator, the locale and the value.
+ */
+type Mp4ItemListBox struct {
+    Mp4Box
+    items []*Mp4IlstItem
+}
+
+func (v *Mp4ItemListBox) Basic() *Mp4Box {
+    return &v.Mp4Box
+}
+
+func (v *Mp4ItemListBox) DecodeHeader(r io.Reader) (err error) {
+    data := make([]uint8, v.left())
+    if err = v.Read(r, data); err != nil {
+        ol.E(nil, fmt.Sprintf("read ilst data failed, err is %v", err))
+        return
+    }
+
+    // The metadata is optional, so ignore the malformed or vendor-specific item,
+    // keep the items decoded and skip the rest of box.
+    for len(data) >= 8 {
+        size, itemType := binary.BigEndian.Uint32(data[0:4]), binary.BigEndian.Uint32(data[4:8])
+        if size < 8 || uint64(size) > uint64(len(data)) {
+            ol.W(nil, fmt.Sprintf("ignore ilst after %v items, invalid item %v, size=%v, left=%v", len(v.items), fourCCString(itemType), size, len(data)))
+            break
+        }
+
+        item, err := v.decodeItem(itemType, data[8:size])
+        if err != nil {
+            ol.W(nil, fmt.Sprintf("ignore ilst after %v items, err is %v", len(v.items), err))
+            break
+        }
+        v.items = append(v.items, item)
+        data = data[size:]
+    }
+
+    ol.I(nil, fmt.Sprintf("decode ilst box success, items=%v", len(v.items)))
+    return
+}
+
+func (v *Mp4ItemListBox) decodeItem(itemType uint32, data []uint8) (item *Mp4IlstItem, err error) {
+    item = &Mp4IlstItem{itemType: itemType}
+
+    for len(data) >= 8 {
+        size, atomType := binary.BigEndian.Uint32(data[0:4]), binary.BigEndian.Uint32(data[4:8])
+        if size < 8 || uint64(size) > uint64(len(data)) {
+            return nil, fmt.Errorf("invalid ilst atom %v, size=%v, left=%v", fourCCString(atomType), size, len(data))
+        }
+        payload := data[8:size]
+        data = data[size:]
+
+        switch atomType {
+        case SrsMp4IlstAtomData:
+            // The type indicator and locale, use the first data atom, for example, the first cover.
+            if len(payload) < 8 {
+                return nil, fmt.Errorf("invalid ilst data atom, size=%v", len(payload))
+            }
+            if item.data == nil {
+                item.dataType = binary.BigEndian.Uint32(payload[0:4]) & 0x00ffffff
+                item.data = payload[8:]
+            }
+        case SrsMp4IlstAtomMean, SrsMp4IlstAtomName:
+            // The version and flags, then the string.
+            if len(payload) < 4 {
+                return nil, fmt.Errorf("invalid ilst %v atom, size=%v", fourCCString(atomType), len(payload))
+            }
+            if atomType == SrsMp4IlstAtomMean {
+                item.mean = string(payload[4:])
+            } else {
+                item.name = string(payload[4:])
+            }
+        }
+    }
+    return
+}
+
 /**
  * 8.1.1 Media Data Box (mdat)
  * ISO_IEC_14496-12-base-format-2012.pdf, page 29
@@ -0,0 +1,166 @@
+package main
+
+import (
+    "bytes"
+    "encoding/binary"
+    "testing"
+)
+
+// Build the box of type and payloads, the size is zero when the box extends to eof.
+func makeBox(bt string, eof bool, payloads ...[]byte) []byte {
+    payload := bytes.Join(payloads, nil)
+    b := make([]byte, 8, 8 + len(payload))
+    if !eof {
+        binary.BigEndian.PutUint32(b, uint32(8 + len(payload)))
+    }
+    copy(b[4:], bt)
+    return append(b, payload...)
+}
+
+func decodeBox(data []byte, topLevel bool) (box Box, err error) {
+    r := bytes.NewReader(data)
+    mb := NewMp4Box()
+    if topLevel {
+        box, err = mb.discoveryTopLevel(r)
+    } else {
+        box, err = mb.discovery(r)
+    }
+    if err != nil {
+        return
+    }
+    if err = box.DecodeHeader(r); err != nil {
+        return
+    }
+    err = box.Basic().DecodeBoxes(r)
+    return
+}
+
+func TestMp4Box_eofSize(t *testing.T) {
+    // The top-level mdat extends to the end of file.
+    box, err := decodeBox(makeBox("mdat", true, make([]byte, 16)), true)
+    if err != nil {
+        t.Fatalf("decode top-level mdat failed, err is %v", err)
+    }
+    if box.Basic().sz() != 8 + 16 {
+        t.Errorf("mdat size is %v, expect %v", box.Basic().sz(), 8 + 16)
+    }
+
+    // The contained box never extends to the end of file.
+    data := makeBox("moov", false, makeBox("free", true, make([]byte, 16)), makeBox("free", false))
+    if _, err = decodeBox(data, true); err == nil {
+        t.Errorf("should fail for contained box extends to eof")
+    }
+    if _, err = decodeBox(makeBox("mdat", true, make([]byte, 16)), false); err == nil {
+        t.Errorf("should fail for not top-level box extends to eof")
+    }
+}
+
+// Build the full box of type, version and flags.
+func makeFullBox(bt string, version uint8, flags uint32, payloads ...[]byte) []byte {
+    vf := make([]byte, 4)
+    binary.BigEndian.PutUint32(vf, uint32(version) << 24 | flags & 0xffffff)
+    return makeBox(bt, false, append([][]byte{vf}, payloads...)...)
+}
+
+func TestMp4CompactSampleSizeBox(t *testing.T) {
+    for _, c := range []struct {
+        fieldSize uint8
+        count uint32
+        entries []byte
+        expect []uint32
+    }{
+        // The 4 bits sizes, the first in the upper nibble, and the last nibble of odd count is padding.
+        {4, 3, []byte{0x12, 0xf0}, []uint32{1, 2, 15}},
+        {4, 4, []byte{0x12, 0x34}, []uint32{1, 2, 3, 4}},
+        {4, 1, []byte{0x70}, []uint32{7}},
+        {8, 3, []byte{0x01, 0x80, 0xff}, []uint32{1, 0x80, 0xff}},
+        {16, 2, []byte{0x01, 0x02, 0xff, 0xff}, []uint32{0x102, 0xffff}},
+        {4, 0, nil, nil},
+    } {
+        header := []byte{0, 0, 0, c.fieldSize, 0, 0, 0, 0}
+        binary.BigEndian.PutUint32(header[4:], c.count)
+
+        box, err := decodeBox(makeFullBox("stz2", 0, 0, header, c.entries), false)
+        if err != nil {
+            t.Fatalf("field size %v, decode failed, err is %v", c.fieldSize, err)
+        }
+        stz2 := box.(*Mp4CompactSampleSizeBox)
+
+        if stz2.getSampleCount() != c.count {
+            t.Errorf("field size %v, count is %v, expect %v", c.fieldSize, stz2.getSampleCount(), c.count)
+        }
+        for i, expect := range c.expect {
+            if size, err := stz2.getSampleSize(uint32(i)); err != nil || size != expect {
+                t.Errorf("field size %v, sample %v size is %v, err is %v, expect %v", c.fieldSize, i, size, err, expect)
+            }
+        }
+        if _, err := stz2.getSampleSize(c.count); err == nil {
+            t.Errorf("field size %v, should fail for sample %v overflow", c.fieldSize, c.count)
+        }
+    }
+
+    // The truncated entries.
+    if _, err := decodeBox(makeFullBox("stz2", 0, 0, []byte{0, 0, 0, 4, 0, 0, 0, 5}, []byte{0x12}), false); err == nil {
+        t.Errorf("should fail for truncated entries")
+    }
+}
+
+func TestMp4TrackInfo_String(t *testing.T) {
+    for _, c := range []struct {
+        info *Mp4TrackInfo
+        expect string
+    }{
+        {&Mp4TrackInfo{TrackId: 1, TrackType: SrsMp4TrackTypeVideo, Codec: "avc1", Language: "und"}, "track:1, type:video, codec:avc1, language:und, name:"},
+        {&Mp4TrackInfo{TrackId: 2, TrackType: SrsMp4TrackTypeAudio, Codec: "mp4a", Language: "eng", HandlerName: "Sound"}, "track:2, type:audio, codec:mp4a, language:eng, name:Sound"},
+        {&Mp4TrackInfo{TrackId: 3, TrackType: SrsMp4TrackTypeSubtitle, Codec: "tx3g"}, "track:3, type:subtitle, codec:tx3g, language:, name:"},
+        {&Mp4TrackInfo{TrackId: 4}, "track:4, type:unknown(0), codec:, language:, name:"},
+    } {
+        if s := c.info.String(); s != c.expect {
+            t.Errorf("got %v, expect %v", s, c.expect)
+        }
+    }
+}
+
+func TestMp4MetaBox_malformed(t *testing.T) {
+    hdlr := makeFullBox("hdlr", 0, 0, make([]byte, 4), []byte("mdir"), make([]byte, 13))
+    title := makeBox("\xa9nam", false, makeBox("data", false, []byte{0, 0, 0, 1, 0, 0, 0, 0}, []byte("Title")))
+    // The vendor-specific item with invalid size.
+    broken := []byte{0, 0, 0, 0xff, 'x', 'y', 'z', 'w', 0, 0}
+    // The item with truncated data atom.
+    truncated := makeBox("\xa9ART", false, makeBox("data", false, []byte{0, 0, 0, 1}))
+
+    for _, c := range []struct {
+        name string
+        meta []byte
+        items int
+    }{
+        {"broken item", makeFullBox("meta", 0, 0, hdlr, makeBox("ilst", false, title, broken)), 1},
+        {"truncated item", makeFullBox("meta", 0, 0, hdlr, makeBox("ilst", false, title, truncated, title)), 1},
+        {"broken box", makeFullBox("meta", 0, 0, hdlr, makeBox("ilst", false, title), []byte{0, 0, 0, 0, 'f', 'r', 'e', 'e'}), 1},
+        {"too small", makeBox("meta", false, []byte{0, 0}), -1},
+    } {
+        // The meta in moov, the free box after meta must be decoded.
+        box, err := decodeBox(makeBox("moov", false, c.meta, makeBox("free", false)), true)
+        if err != nil {
+            t.Fatalf("%v, decode moov failed, err is %v", c.name, err)
+        }
+        moov := box.(*Mp4MovieBox)
+        if len(moov.Boxes) != 2 {
+            t.Errorf("%v, moov boxes is %v, expect 2", c.name, len(moov.Boxes))
+        }
+
+        ilst, err := moov.Ilst()
+        if c.items < 0 {
+            if err == nil {
+                t.Errorf("%v, should no ilst", c.name)
+            }
+            continue
+        }
+        if err != nil {
+            t.Fatalf("%v, no ilst, err is %v", c.name, err)
+        }
+        if len(ilst.items) != c.items || ilst.items[0].value() != "Title" {
+            t.Errorf("%v, items is %v", c.name, ilst.items)
+        }
+    }
+}
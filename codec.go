@@ -0,0 +1,774 @@
+package main
+
+import (
+    "fmt"
+)
+
+// The bit reader for the RBSP of H.264, read the bits in big-endian and the Exp-Golomb codes.
+type BitBuffer struct {
+    data []byte
+    // The position in bits.
+    pos int
+}
+
+func NewBitBuffer(data []byte) *BitBuffer {
+    v := &BitBuffer{
+        data: data,
+    }
+    return v
+}
+
+// Read n bits, n should not be larger than 32.
+func (v *BitBuffer) readBits(n int) (value uint32, err error) {
+    if v.pos + n > len(v.data) * 8 {
+        return 0, fmt.Errorf("requires %v bits, left %v bits", n, len(v.data) * 8 - v.pos)
+    }
+    for i := 0; i < n; i++ {
+        bit := (v.data[v.pos / 8] >> uint(7 - v.pos % 8)) & 0x01
+        value = value << 1 | uint32(bit)
+        v.pos++
+    }
+    return
+}
+
+func (v *BitBuffer) readBit() (value bool, err error) {
+    var bit uint32
+    if bit, err = v.readBits(1); err != nil {
+        return
+    }
+    return bit == 1, nil
+}
+
+// The number of bits left.
+func (v *BitBuffer) left() int {
+    return len(v.data) * 8 - v.pos
+}
+
+func (v *BitBuffer) skipBits(n int) (err error) {
+    if v.pos + n > len(v.data) * 8 {
+        return fmt.Errorf("requires %v bits, left %v bits", n, len(v.data) * 8 - v.pos)
+    }
+    v.pos += n
+    return
+}
+
+/**
+ * 9.1 Parsing process for Exp-Golomb codes, the ue(v).
+ * ISO_IEC_14496-10-AVC-2012.pdf, page 227.
+ */
+func (v *BitBuffer) readUE() (value uint32, err error) {
+    leadingZeroBits := 0
+    for {
+        var bit bool
+        if bit, err = v.readBit(); err != nil {
+            return
+        }
+        if bit {
+            break
+        }
+        if leadingZeroBits++; leadingZeroBits > 31 {
+            return 0, fmt.Errorf("ue overflow, leading zero bits=%v", leadingZeroBits)
+        }
+    }
+
+    var bits uint32
+    if bits, err = v.readBits(leadingZeroBits); err != nil {
+        return
+    }
+    return (1 << uint(leadingZeroBits)) - 1 + bits, nil
+}
+
+/**
+ * 9.1.1 Mapping process for signed Exp-Golomb codes, the se(v).
+ * ISO_IEC_14496-10-AVC-2012.pdf, page 228.
+ */
+func (v *BitBuffer) readSE() (value int32, err error) {
+    var codeNum uint32
+    if codeNum, err = v.readUE(); err != nil {
+        return
+    }
+    if codeNum & 0x01 == 1 {
+        return int32((codeNum + 1) / 2), nil
+    }
+    return -int32(codeNum / 2), nil
+}
+
+/**
+ * 7.4.1 NAL unit semantics, remove the emulation_prevention_three_byte.
+ * ISO_IEC_14496-10-AVC-2012.pdf, page 65.
+ * The 0x000003 in NALU is 0x0000 in RBSP.
+ */
+func nalu2rbsp(nalu []byte) (rbsp []byte) {
+    rbsp = make([]byte, 0, len(nalu))
+    zeros := 0
+    for _, b := range nalu {
+        if zeros >= 2 && b == 0x03 {
+            zeros = 0
+            continue
+        }
+        rbsp = append(rbsp, b)
+        if b == 0x00 {
+            zeros++
+        } else {
+            zeros = 0
+        }
+    }
+    return
+}
+
+/**
+ * 5.2.4.1 AVC decoder configuration record
+ * ISO_IEC_14496-15-AVC-format-2012.pdf, page 16
+ */
+type AvcDecoderConfigurationRecord struct {
+    configurationVersion uint8
+    AVCProfileIndication uint8
+    profileCompatibility uint8
+    AVCLevelIndication uint8
+    // The lengthSizeMinusOne plus one, the size of NALU length in bytes.
+    naluLengthSize int
+    // The SPS and PPS NALUs, with the NALU header.
+    spss [][]byte
+    ppss [][]byte
+}
+
+func NewAvcDecoderConfigurationRecord() *AvcDecoderConfigurationRecord {
+    v := &AvcDecoderConfigurationRecord{
+        spss: [][]byte{},
+        ppss: [][]byte{},
+    }
+    return v
+}
+
+// Decode the record, the extensions for high profiles after the PPS are ignored.
+func (v *AvcDecoderConfigurationRecord) Decode(data []byte) (err error) {
+    if len(data) < 6 {
+        return fmt.Errorf("avcc record requires 6 bytes, actual is %v", len(data))
+    }
+    v.configurationVersion = data[0]
+    v.AVCProfileIndication = data[1]
+    v.profileCompatibility = data[2]
+    v.AVCLevelIndication = data[3]
+    v.naluLengthSize = int(data[4] & 0x03) + 1
+
+    // The nalus is 16 bits length and the payload.
+    readNalus := func(p []byte, count int) (nalus [][]byte, left []byte, err error) {
+        for i := 0; i < count; i++ {
+            if len(p) < 2 {
+                return nil, nil, fmt.Errorf("nalu %v requires 2 bytes, actual is %v", i, len(p))
+            }
+            size := int(p[0]) << 8 | int(p[1])
+            if len(p) < 2 + size {
+                return nil, nil, fmt.Errorf("nalu %v requires %v bytes, actual is %v", i, size, len(p) - 2)
+            }
+            nalus = append(nalus, p[2:2 + size])
+            p = p[2 + size:]
+        }
+        return nalus, p, nil
+    }
+
+    p := data[6:]
+    if v.spss, p, err = readNalus(p, int(data[5] & 0x1f)); err != nil {
+        return fmt.Errorf("read sps failed, err is %v", err)
+    }
+    if len(p) < 1 {
+        return fmt.Errorf("avcc record requires numOfPictureParameterSets")
+    }
+    if v.ppss, _, err = readNalus(p[1:], int(p[0])); err != nil {
+        return fmt.Errorf("read pps failed, err is %v", err)
+    }
+    return
+}
+
+/**
+ * 7.3.2.1.1 Sequence parameter set data syntax
+ * ISO_IEC_14496-10-AVC-2012.pdf, page 44.
+ * We only parse the fields about the size, the chroma format and the frame rate.
+ */
+type AvcSps struct {
+    profileIdc uint8
+    constraintFlags uint8
+    levelIdc uint8
+    spsId uint32
+    // The chroma_format_idc, 0 for monochrome, 1 for 4:2:0, 2 for 4:2:2, 3 for 4:4:4.
+    chromaFormatIdc uint32
+    separateColourPlane bool
+    bitDepthLuma uint32
+    bitDepthChroma uint32
+    frameMbsOnly bool
+    // The width and height after cropped.
+    width uint32
+    height uint32
+    // The frame rate from VUI timing info, 0 if not present.
+    frameRate float64
+}
+
+func NewAvcSps() *AvcSps {
+    v := &AvcSps{
+        chromaFormatIdc: 1,
+        bitDepthLuma: 8,
+        bitDepthChroma: 8,
+    }
+    return v
+}
+
+// Decode the SPS NALU, with the NALU header.
+func (v *AvcSps) Decode(nalu []byte) (err error) {
+    if len(nalu) < 4 {
+        return fmt.Errorf("sps requires 4 bytes, actual is %v", len(nalu))
+    }
+    if naluType := nalu[0] & 0x1f; naluType != SrsAvcNaluTypeSPS {
+        return fmt.Errorf("nalu type %v is not sps", naluType)
+    }
+
+    rbsp := nalu2rbsp(nalu[1:])
+    if len(rbsp) < 3 {
+        return fmt.Errorf("sps rbsp requires 3 bytes, actual is %v", len(rbsp))
+    }
+    v.profileIdc = rbsp[0]
+    v.constraintFlags = rbsp[1]
+    v.levelIdc = rbsp[2]
+
+    b := NewBitBuffer(rbsp[3:])
+    if v.spsId, err = b.readUE(); err != nil {
+        return fmt.Errorf("read sps id failed, err is %v", err)
+    }
+
+    switch v.profileIdc {
+    case 100, 110, 122, 244, 44, 83, 86, 118, 128, 138, 139, 134, 135:
+        if err = v.decodeChroma(b); err != nil {
+            return
+        }
+    }
+
+    // The log2_max_frame_num_minus4 and pic_order_cnt_type.
+    if _, err = b.readUE(); err != nil {
+        return fmt.Errorf("read log2_max_frame_num failed, err is %v", err)
+    }
+    var pocType uint32
+    if pocType, err = b.readUE(); err != nil {
+        return fmt.Errorf("read pic_order_cnt_type failed, err is %v", err)
+    }
+    if pocType == 0 {
+        if _, err = b.readUE(); err != nil {
+            return fmt.Errorf("read log2_max_pic_order_cnt_lsb failed, err is %v", err)
+        }
+    } else if pocType == 1 {
+        if err = b.skipBits(1); err != nil {
+            return fmt.Errorf("read delta_pic_order_always_zero failed, err is %v", err)
+        }
+        if _, err = b.readSE(); err != nil {
+            return fmt.Errorf("read offset_for_non_ref_pic failed, err is %v", err)
+        }
+        if _, err = b.readSE(); err != nil {
+            return fmt.Errorf("read offset_for_top_to_bottom_field failed, err is %v", err)
+        }
+        var nbRefFrames uint32
+        if nbRefFrames, err = b.readUE(); err != nil {
+            return fmt.Errorf("read num_ref_frames_in_pic_order_cnt_cycle failed, err is %v", err)
+        }
+        for i := uint32(0); i < nbRefFrames; i++ {
+            if _, err = b.readSE(); err != nil {
+                return fmt.Errorf("read offset_for_ref_frame failed, err is %v", err)
+            }
+        }
+    }
+
+    // The max_num_ref_frames and gaps_in_frame_num_value_allowed_flag.
+    if _, err = b.readUE(); err != nil {
+        return fmt.Errorf("read max_num_ref_frames failed, err is %v", err)
+    }
+    if err = b.skipBits(1); err != nil {
+        return fmt.Errorf("read gaps_in_frame_num_value_allowed failed, err is %v", err)
+    }
+
+    var widthInMbs, heightInMapUnits uint32
+    if widthInMbs, err = b.readUE(); err != nil {
+        return fmt.Errorf("read pic_width_in_mbs failed, err is %v", err)
+    }
+    if heightInMapUnits, err = b.readUE(); err != nil {
+        return fmt.Errorf("read pic_height_in_map_units failed, err is %v", err)
+    }
+    if v.frameMbsOnly, err = b.readBit(); err != nil {
+        return fmt.Errorf("read frame_mbs_only failed, err is %v", err)
+    }
+    if !v.frameMbsOnly {
+        if err = b.skipBits(1); err != nil {
+            return fmt.Errorf("read mb_adaptive_frame_field failed, err is %v", err)
+        }
+    }
+    if err = b.skipBits(1); err != nil {
+        return fmt.Errorf("read direct_8x8_inference failed, err is %v", err)
+    }
+
+    // The frame size in MBs, the field MBs pair is a frame MB.
+    frameMbsOnly := uint32(0)
+    if v.frameMbsOnly {
+        frameMbsOnly = 1
+    }
+    v.width = (widthInMbs + 1) * 16
+    v.height = (2 - frameMbsOnly) * (heightInMapUnits + 1) * 16
+
+    var cropping bool
+    if cropping, err = b.readBit(); err != nil {
+        return fmt.Errorf("read frame_cropping failed, err is %v", err)
+    }
+    if cropping {
+        var left, right, top, bottom uint32
+        for _, p := range []*uint32{&left, &right, &top, &bottom} {
+            if *p, err = b.readUE(); err != nil {
+                return fmt.Errorf("read frame_crop_offset failed, err is %v", err)
+            }
+        }
+
+        // The CropUnitX and CropUnitY, see equations 7-19 to 7-22.
+        cropUnitX, cropUnitY := uint32(1), 2 - frameMbsOnly
+        if chromaArrayType := v.chromaFormatIdc; !v.separateColourPlane && chromaArrayType != 0 {
+            subWidthC, subHeightC := uint32(2), uint32(2)
+            if chromaArrayType == 2 {
+                subHeightC = 1
+            } else if chromaArrayType == 3 {
+                subWidthC, subHeightC = 1, 1
+            }
+            cropUnitX, cropUnitY = subWidthC, subHeightC * (2 - frameMbsOnly)
+        }
+
+        if cropX, cropY := cropUnitX * (left + right), cropUnitY * (top + bottom); cropX >= v.width || cropY >= v.height {
+            return fmt.Errorf("invalid crop %vx%v for %vx%v", cropX, cropY, v.width, v.height)
+        } else {
+            v.width -= cropX
+            v.height -= cropY
+        }
+    }
+
+    var vui bool
+    if vui, err = b.readBit(); err != nil {
+        return fmt.Errorf("read vui_parameters_present failed, err is %v", err)
+    }
+    if vui {
+        if err = v.decodeVui(b); err != nil {
+            return
+        }
+    }
+    return
+}
+
+// Decode the chroma format and bit depth, skip the scaling matrix.
+func (v *AvcSps) decodeChroma(b *BitBuffer) (err error) {
+    if v.chromaFormatIdc, err = b.readUE(); err != nil {
+        return fmt.Errorf("read chroma_format_idc failed, err is %v", err)
+    }
+    if v.chromaFormatIdc == 3 {
+        if v.separateColourPlane, err = b.readBit(); err != nil {
+            return fmt.Errorf("read separate_colour_plane failed, err is %v", err)
+        }
+    }
+
+    var bitDepth uint32
+    if bitDepth, err = b.readUE(); err != nil {
+        return fmt.Errorf("read bit_depth_luma failed, err is %v", err)
+    }
+    v.bitDepthLuma = bitDepth + 8
+    if bitDepth, err = b.readUE(); err != nil {
+        return fmt.Errorf("read bit_depth_chroma failed, err is %v", err)
+    }
+    v.bitDepthChroma = bitDepth + 8
+
+    // The qpprime_y_zero_transform_bypass_flag and seq_scaling_matrix_present_flag.
+    if err = b.skipBits(1); err != nil {
+        return fmt.Errorf("read qpprime_y_zero_transform_bypass failed, err is %v", err)
+    }
+    var scalingMatrix bool
+    if scalingMatrix, err = b.readBit(); err != nil {
+        return fmt.Errorf("read seq_scaling_matrix_present failed, err is %v", err)
+    }
+    if !scalingMatrix {
+        return
+    }
+
+    nbLists := 8
+    if v.chromaFormatIdc == 3 {
+        nbLists = 12
+    }
+    for i := 0; i < nbLists; i++ {
+        var present bool
+        if present, err = b.readBit(); err != nil {
+            return fmt.Errorf("read seq_scaling_list_present failed, err is %v", err)
+        }
+        if !present {
+            continue
+        }
+
+        // 7.3.2.1.1.1 Scaling list syntax, 16 for 4x4 and 64 for 8x8.
+        size := 16
+        if i >= 6 {
+            size = 64
+        }
+        lastScale, nextScale := int32(8), int32(8)
+        for j := 0; j < size && nextScale != 0; j++ {
+            var delta int32
+            if delta, err = b.readSE(); err != nil {
+                return fmt.Errorf("read delta_scale failed, err is %v", err)
+            }
+            nextScale = (lastScale + delta + 256) % 256
+            if nextScale != 0 {
+                lastScale = nextScale
+            }
+        }
+    }
+    return
+}
+
+/**
+ * E.1.1 VUI parameters syntax
+ * ISO_IEC_14496-10-AVC-2012.pdf, page 313.
+ * We only parse to the timing info, for the frame rate.
+ */
+func (v *AvcSps) decodeVui(b *BitBuffer) (err error) {
+    var present bool
+    if present, err = b.readBit(); err != nil {
+        return fmt.Errorf("read aspect_ratio_info_present failed, err is %v", err)
+    }
+    if present {
+        var aspectRatioIdc uint32
+        if aspectRatioIdc, err = b.readBits(8); err != nil {
+            return fmt.Errorf("read aspect_ratio_idc failed, err is %v", err)
+        }
+        // The Extended_SAR, the sar_width and sar_height.
+        if aspectRatioIdc == 255 {
+            if err = b.skipBits(32); err != nil {
+                return fmt.Errorf("read sar failed, err is %v", err)
+            }
+        }
+    }
+
+    if present, err = b.readBit(); err != nil {
+        return fmt.Errorf("read overscan_info_present failed, err is %v", err)
+    }
+    if present {
+        if err = b.skipBits(1); err != nil {
+            return fmt.Errorf("read overscan_appropriate failed, err is %v", err)
+        }
+    }
+
+    if present, err = b.readBit(); err != nil {
+        return fmt.Errorf("read video_signal_type_present failed, err is %v", err)
+    }
+    if present {
+        // The video_format, video_full_range_flag and colour_description_present_flag.
+        var colour uint32
+        if colour, err = b.readBits(5); err != nil {
+            return fmt.Errorf("read video_signal_type failed, err is %v", err)
+        }
+        if colour & 0x01 == 1 {
+            if err = b.skipBits(24); err != nil {
+                return fmt.Errorf("read colour_description failed, err is %v", err)
+            }
+        }
+    }
+
+    if present, err = b.readBit(); err != nil {
+        return fmt.Errorf("read chroma_loc_info_present failed, err is %v", err)
+    }
+    if present {
+        if _, err = b.readUE(); err != nil {
+            return fmt.Errorf("read chroma_sample_loc_type_top_field failed, err is %v", err)
+        }
+        if _, err = b.readUE(); err != nil {
+            return fmt.Errorf("read chroma_sample_loc_type_bottom_field failed, err is %v", err)
+        }
+    }
+
+    if present, err = b.readBit(); err != nil {
+        return fmt.Errorf("read timing_info_present failed, err is %v", err)
+    }
+    if !present {
+        return
+    }
+
+    var numUnitsInTick, timeScale uint32
+    if numUnitsInTick, err = b.readBits(32); err != nil {
+        return fmt.Errorf("read num_units_in_tick failed, err is %v", err)
+    }
+    if timeScale, err = b.readBits(32); err != nil {
+        return fmt.Errorf("read time_scale failed, err is %v", err)
+    }
+
+    // The frame rate is time_scale/(2*num_units_in_tick), for a frame is two fields.
+    if numUnitsInTick > 0 {
+        v.frameRate = float64(timeScale) / float64(2 * uint64(numUnitsInTick))
+    }
+    return
+}
+
+/**
+ * 1.6.2.1 AudioSpecificConfig
+ * ISO_IEC_14496-3-AAC-2001.pdf, page 33
+ * The sbr and ps maybe explicit by object type 5 and 29, or backward compatible by the sync extension.
+ */
+type AacAudioSpecificConfig struct {
+    objectType uint8
+    samplingFrequencyIndex uint8
+    samplingFrequency uint32
+    channelConfiguration uint8
+    // The channels, from channel configuration or the program config element.
+    channels int
+    // For SBR, the extension object type is 5, and the sampling frequency is the output frequency.
+    extensionObjectType uint8
+    extensionSamplingFrequency uint32
+    sbr bool
+    ps bool
+}
+
+func NewAacAudioSpecificConfig() *AacAudioSpecificConfig {
+    v := &AacAudioSpecificConfig{}
+    return v
+}
+
+// The output sample rate, which is doubled by SBR.
+func (v *AacAudioSpecificConfig) SampleRate() uint32 {
+    if v.sbr && v.extensionSamplingFrequency > 0 {
+        return v.extensionSamplingFrequency
+    }
+    return v.samplingFrequency
+}
+
+// The output channels, the PS outputs stereo for mono.
+func (v *AacAudioSpecificConfig) Channels() int {
+    if v.ps && v.channels == 1 {
+        return 2
+    }
+    return v.channels
+}
+
+func (v *AacAudioSpecificConfig) Decode(data []byte) (err error) {
+    b := NewBitBuffer(data)
+
+    if v.objectType, err = v.readObjectType(b); err != nil {
+        return
+    }
+    var index uint8
+    if index, v.samplingFrequency, err = v.readSamplingFrequency(b); err != nil {
+        return
+    }
+    v.samplingFrequencyIndex = index
+
+    var channelConfiguration uint32
+    if channelConfiguration, err = b.readBits(4); err != nil {
+        return fmt.Errorf("read channel configuration failed, err is %v", err)
+    }
+    v.channelConfiguration = uint8(channelConfiguration)
+    v.channels = aacChannels(v.channelConfiguration)
+
+    // The explicit SBR, the object type is the core codec after the extension frequency.
+    if v.objectType == SrsAacObjectTypeAacHE || v.objectType == SrsAacObjectTypeAacHEV2 {
+        v.extensionObjectType = SrsAacObjectTypeAacHE
+        v.sbr = true
+        v.ps = v.objectType == SrsAacObjectTypeAacHEV2
+        if _, v.extensionSamplingFrequency, err = v.readSamplingFrequency(b); err != nil {
+            return
+        }
+        if v.objectType, err = v.readObjectType(b); err != nil {
+            return
+        }
+        if v.objectType == SrsAacObjectTypeErBSAC {
+            if err = b.skipBits(4); err != nil {
+                return fmt.Errorf("read extension channel configuration failed, err is %v", err)
+            }
+        }
+    }
+
+    switch v.objectType {
+    case SrsAacObjectTypeAacMain, SrsAacObjectTypeAacLC, SrsAacObjectTypeAacSSR, SrsAacObjectTypeAacLTP,
+        SrsAacObjectTypeAacScalable, SrsAacObjectTypeTwinVQ, SrsAacObjectTypeErAacLC, SrsAacObjectTypeErAacLTP,
+        SrsAacObjectTypeErAacScalable, SrsAacObjectTypeErTwinVQ, SrsAacObjectTypeErBSAC, SrsAacObjectTypeErAacLD:
+        if err = v.decodeGASpecificConfig(b); err != nil {
+            return
+        }
+    default:
+        // For other object types, we only know the frequency and channels.
+        return
+    }
+
+    // The backward compatible SBR and PS signalling, in the sync extension.
+    if v.extensionObjectType != SrsAacObjectTypeAacHE && b.left() >= 16 {
+        var syncExtensionType uint32
+        if syncExtensionType, err = b.readBits(11); err != nil || syncExtensionType != 0x2b7 {
+            return nil
+        }
+        var extensionObjectType uint8
+        if extensionObjectType, err = v.readObjectType(b); err != nil {
+            return
+        }
+        if extensionObjectType != SrsAacObjectTypeAacHE {
+            return
+        }
+        v.extensionObjectType = extensionObjectType
+        if v.sbr, err = b.readBit(); err != nil {
+            return fmt.Errorf("read sbr present failed, err is %v", err)
+        }
+        if !v.sbr {
+            return
+        }
+        if _, v.extensionSamplingFrequency, err = v.readSamplingFrequency(b); err != nil {
+            return
+        }
+        if b.left() >= 12 {
+            if syncExtensionType, err = b.readBits(11); err != nil || syncExtensionType != 0x548 {
+                return nil
+            }
+            if v.ps, err = b.readBit(); err != nil {
+                return fmt.Errorf("read ps present failed, err is %v", err)
+            }
+        }
+    }
+    return
+}
+
+// Read the audio object type, 5 bits or 32 plus 6 bits for escape.
+func (v *AacAudioSpecificConfig) readObjectType(b *BitBuffer) (objectType uint8, err error) {
+    var value uint32
+    if value, err = b.readBits(5); err != nil {
+        return 0, fmt.Errorf("read object type failed, err is %v", err)
+    }
+    if value == SrsAacObjectTypeEscape {
+        if value, err = b.readBits(6); err != nil {
+            return 0, fmt.Errorf("read object type ext failed, err is %v", err)
+        }
+        value += 32
+    }
+    return uint8(value), nil
+}
+
+// Read the sampling frequency index, or the explicit 24 bits frequency for index 0xf.
+func (v *AacAudioSpecificConfig) readSamplingFrequency(b *BitBuffer) (index uint8, frequency uint32, err error) {
+    var value uint32
+    if value, err = b.readBits(4); err != nil {
+        return 0, 0, fmt.Errorf("read sampling frequency index failed, err is %v", err)
+    }
+    index = uint8(value)
+
+    if index == 0x0f {
+        if frequency, err = b.readBits(24); err != nil {
+            return 0, 0, fmt.Errorf("read sampling frequency failed, err is %v", err)
+        }
+        return
+    }
+    if int(index) >= len(SrsAacSampleRates) {
+        return 0, 0, fmt.Errorf("invalid sampling frequency index %v", index)
+    }
+    return index, SrsAacSampleRates[index], nil
+}
+
+/**
+ * 4.4.1 GASpecificConfig
+ * ISO_IEC_14496-3-AAC-2001.pdf, page 240
+ */
+func (v *AacAudioSpecificConfig) decodeGASpecificConfig(b *BitBuffer) (err error) {
+    // The frameLengthFlag and dependsOnCoreCoder.
+    if err = b.skipBits(1); err != nil {
+        return fmt.Errorf("read frame length flag failed, err is %v", err)
+    }
+    var dependsOnCoreCoder bool
+    if dependsOnCoreCoder, err = b.readBit(); err != nil {
+        return fmt.Errorf("read depends on core coder failed, err is %v", err)
+    }
+    if dependsOnCoreCoder {
+        if err = b.skipBits(14); err != nil {
+            return fmt.Errorf("read core coder delay failed, err is %v", err)
+        }
+    }
+    var extensionFlag bool
+    if extensionFlag, err = b.readBit(); err != nil {
+        return fmt.Errorf("read extension flag failed, err is %v", err)
+    }
+
+    if v.channelConfiguration == 0 {
+        if v.channels, err = v.decodeProgramConfigElement(b); err != nil {
+            return
+        }
+    }
+
+    if v.objectType == SrsAacObjectTypeAacScalable || v.objectType == SrsAacObjectTypeErAacScalable {
+        if err = b.skipBits(3); err != nil {
+            return fmt.Errorf("read layer nr failed, err is %v", err)
+        }
+    }
+    if extensionFlag {
+        switch v.objectType {
+        case SrsAacObjectTypeErBSAC:
+            err = b.skipBits(5 + 11)
+        case SrsAacObjectTypeErAacLC, SrsAacObjectTypeErAacLTP, SrsAacObjectTypeErAacScalable, SrsAacObjectTypeErAacLD:
+            err = b.skipBits(3)
+        }
+        if err == nil {
+            err = b.skipBits(1)
+        }
+        if err != nil {
+            return fmt.Errorf("read extension failed, err is %v", err)
+        }
+    }
+    return
+}
+
+/**
+ * 4.4.1.1 Program config element, to get the number of channels.
+ * ISO_IEC_14496-3-AAC-2001.pdf, page 242
+ */
+func (v *AacAudioSpecificConfig) decodeProgramConfigElement(b *BitBuffer) (channels int, err error) {
+    // The element_instance_tag, object_type and sampling_frequency_index.
+    if err = b.skipBits(4 + 2 + 4); err != nil {
+        return 0, fmt.Errorf("read pce failed, err is %v", err)
+    }
+
+    nbElements := make([]uint32, 6)
+    for i, n := range []int{4, 4, 4, 2, 3, 4} {
+        if nbElements[i], err = b.readBits(n); err != nil {
+            return 0, fmt.Errorf("read pce elements failed, err is %v", err)
+        }
+    }
+    nbFront, nbSide, nbBack, nbLfe := nbElements[0], nbElements[1], nbElements[2], nbElements[3]
+
+    // The mono, stereo and matrix mixdown.
+    for _, n := range []int{4, 4, 3} {
+        var present bool
+        if present, err = b.readBit(); err != nil {
+            return 0, fmt.Errorf("read pce mixdown failed, err is %v", err)
+        }
+        if present {
+            if err = b.skipBits(n); err != nil {
+                return 0, fmt.Errorf("read pce mixdown failed, err is %v", err)
+            }
+        }
+    }
+
+    // The front, side and back elements, the CPE is two channels.
+    for i := uint32(0); i < nbFront + nbSide + nbBack; i++ {
+        var isCpe bool
+        if isCpe, err = b.readBit(); err != nil {
+            return 0, fmt.Errorf("read pce element failed, err is %v", err)
+        }
+        if err = b.skipBits(4); err != nil {
+            return 0, fmt.Errorf("read pce element failed, err is %v", err)
+        }
+        if channels++; isCpe {
+            channels++
+        }
+    }
+    channels += int(nbLfe)
+    return
+}
+
+// The channels of channel configuration, 0 for defined in PCE.
+// @see 1.6.3.5 channelConfiguration, ISO_IEC_14496-3-AAC-2001.pdf, page 35
+func aacChannels(channelConfiguration uint8) int {
+    switch channelConfiguration {
+    case 1, 2, 3, 4, 5, 6:
+        return int(channelConfiguration)
+    case 7, 12, 14:
+        return 8
+    case 11:
+        return 7
+    }
+    return 0
+}
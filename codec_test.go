@@ -0,0 +1,131 @@
+package main
+
+import (
+    "bytes"
+    "testing"
+)
+
+// The x264 High 4.0 SPS and PPS of 1920x1080 at 25fps, the height is cropped from 1088.
+var x264Sps = []byte{
+    0x67, 0x64, 0x00, 0x28, 0xac, 0xd9, 0x40, 0x78, 0x02, 0x27, 0xe5, 0xc0, 0x44, 0x00,
+    0x00, 0x03, 0x00, 0x04, 0x00, 0x00, 0x03, 0x00, 0xc8, 0x3c, 0x60, 0xc6, 0x58,
+}
+var x264Pps = []byte{0x68, 0xeb, 0xe3, 0xcb, 0x22, 0xc0}
+
+func TestAvcSps_Decode(t *testing.T) {
+    for _, c := range []struct {
+        name string
+        sps []byte
+        profile uint8
+        chroma uint32
+        width, height uint32
+        frameRate float64
+    }{
+        {"x264 1080p", x264Sps, 100, 1, 1920, 1080, 25},
+        // The High profile with the scaling lists, the default, the 4x4 and the 8x8 list.
+        {"scaling matrix", []byte{
+            0x67, 0x64, 0x00, 0x28, 0xad, 0x84, 0x61, 0x0f, 0xff, 0xe1, 0xff, 0xff, 0xff, 0xff,
+            0xff, 0xff, 0xff, 0xff, 0x6c, 0xa0, 0x28, 0x02, 0xdc, 0x80,
+        }, 100, 1, 1280, 720, 0},
+        // The High 4:2:2 profile, the crop unit of height is 1 line.
+        {"4:2:2 crop", []byte{
+            0x67, 0x7a, 0x00, 0x28, 0xbc, 0xd9, 0x40, 0x78, 0x02, 0x27, 0xe2, 0x50,
+        }, 122, 2, 1920, 1080, 0},
+        // The Main profile of field MBs, the crop unit of height is 4 lines, at 30000/1001 fps.
+        {"interlaced", []byte{
+            0x67, 0x4d, 0x00, 0x28, 0xec, 0xa0, 0x3c, 0x02, 0x23, 0xef, 0x01, 0x10, 0x00, 0x00,
+            0x3e, 0x90, 0x00, 0x0e, 0xa6, 0x0c,
+        }, 77, 1, 1920, 1080, 30000.0 / 1001},
+    } {
+        sps := NewAvcSps()
+        if err := sps.Decode(c.sps); err != nil {
+            t.Errorf("%v, decode failed, err is %v", c.name, err)
+            continue
+        }
+        if sps.profileIdc != c.profile || sps.chromaFormatIdc != c.chroma {
+            t.Errorf("%v, profile is %v, chroma is %v, expect %v, %v", c.name, sps.profileIdc, sps.chromaFormatIdc, c.profile, c.chroma)
+        }
+        if sps.width != c.width || sps.height != c.height {
+            t.Errorf("%v, size is %vx%v, expect %vx%v", c.name, sps.width, sps.height, c.width, c.height)
+        }
+        if sps.frameRate != c.frameRate {
+            t.Errorf("%v, frame rate is %v, expect %v", c.name, sps.frameRate, c.frameRate)
+        }
+    }
+
+    // The truncated SPS, and the NALU which is not SPS.
+    for _, nalu := range [][]byte{x264Sps[:4], x264Sps[:8], x264Sps[:14], x264Pps, {0x67, 0x64}} {
+        if err := NewAvcSps().Decode(nalu); err == nil {
+            t.Errorf("should fail for nalu %x", nalu)
+        }
+    }
+}
+
+func TestAvcDecoderConfigurationRecord_Decode(t *testing.T) {
+    avcc := append([]byte{0x01, 0x64, 0x00, 0x28, 0xff, 0xe1, 0x00, byte(len(x264Sps))}, x264Sps...)
+    avcc = append(avcc, 0x01, 0x00, byte(len(x264Pps)))
+    avcc = append(avcc, x264Pps...)
+
+    v := NewAvcDecoderConfigurationRecord()
+    if err := v.Decode(avcc); err != nil {
+        t.Fatalf("decode failed, err is %v", err)
+    }
+    if v.AVCProfileIndication != 100 || v.AVCLevelIndication != 40 || v.naluLengthSize != 4 {
+        t.Errorf("profile is %v, level is %v, nalu length size is %v", v.AVCProfileIndication, v.AVCLevelIndication, v.naluLengthSize)
+    }
+    if len(v.spss) != 1 || !bytes.Equal(v.spss[0], x264Sps) {
+        t.Errorf("sps is %x", v.spss)
+    }
+    if len(v.ppss) != 1 || !bytes.Equal(v.ppss[0], x264Pps) {
+        t.Errorf("pps is %x", v.ppss)
+    }
+
+    // The truncated record, in the header, the SPS, the count of PPS and the PPS.
+    for _, n := range []int{5, 8, 20, 8 + len(x264Sps), len(avcc) - 1} {
+        if err := NewAvcDecoderConfigurationRecord().Decode(avcc[:n]); err == nil {
+            t.Errorf("should fail for %v bytes", n)
+        }
+    }
+}
+
+func TestAacAudioSpecificConfig_Decode(t *testing.T) {
+    for _, c := range []struct {
+        name string
+        asc []byte
+        objectType uint8
+        sampleRate uint32
+        channels int
+    }{
+        {"LC 48k stereo", []byte{0x11, 0x90}, SrsAacObjectTypeAacLC, 48000, 2},
+        // The explicit SBR and PS, the core is LC at 24k, output at 48k.
+        {"HE-AAC v1", []byte{0x2b, 0x11, 0x88, 0x00}, SrsAacObjectTypeAacLC, 48000, 2},
+        {"HE-AAC v2", []byte{0xeb, 0x09, 0x88, 0x00}, SrsAacObjectTypeAacLC, 48000, 2},
+        // The backward compatible SBR and PS, in the 0x2b7 and 0x548 sync extension.
+        {"implicit SBR", []byte{0x13, 0x10, 0x56, 0xe5, 0x98}, SrsAacObjectTypeAacLC, 48000, 2},
+        {"implicit PS", []byte{0x13, 0x08, 0x56, 0xe5, 0x9d, 0x48, 0x80}, SrsAacObjectTypeAacLC, 48000, 2},
+        {"implicit no SBR", []byte{0x11, 0x90, 0x56, 0xe5, 0x00}, SrsAacObjectTypeAacLC, 48000, 2},
+        // The escape index 0xf, the explicit 24 bits sampling frequency.
+        {"escape frequency", []byte{0x17, 0x80, 0x56, 0x0c, 0x10}, SrsAacObjectTypeAacLC, 44056, 2},
+        // The channel configuration 0, the PCE with front SCE and CPE, back CPE and LFE.
+        {"PCE 5.1", []byte{0x11, 0x80, 0x04, 0xc8, 0x05, 0x00, 0x01, 0x19, 0x00}, SrsAacObjectTypeAacLC, 48000, 6},
+    } {
+        asc := NewAacAudioSpecificConfig()
+        if err := asc.Decode(c.asc); err != nil {
+            t.Errorf("%v, decode failed, err is %v", c.name, err)
+            continue
+        }
+        if asc.objectType != c.objectType {
+            t.Errorf("%v, object type is %v, expect %v", c.name, asc.objectType, c.objectType)
+        }
+        if asc.SampleRate() != c.sampleRate || asc.Channels() != c.channels {
+            t.Errorf("%v, got %vHz %v channels, expect %vHz %v channels", c.name, asc.SampleRate(), asc.Channels(), c.sampleRate, c.channels)
+        }
+    }
+
+    // The truncated config, in the frequency, the explicit SBR and the PCE.
+    for _, asc := range [][]byte{{0x11}, {0x2b, 0x11}, {0x17, 0x80, 0x56}, {0x11, 0x80, 0x04}} {
+        if err := NewAacAudioSpecificConfig().Decode(asc); err == nil {
+            t.Errorf("should fail for asc %x", asc)
+        }
+    }
+}
@@ -1,5 +1,7 @@
 package main
 
+import "fmt"
+
 const (
     SRS_MP4_EOF_SIZE = 0
     SRS_MP4_USE_LARGE_SIZE = 1
@@ -15,6 +17,8 @@ const (
     SrsMp4BoxTypeMVHD = 0x6d766864 // 'mvhd'
     SrsMp4BoxTypeTRAK = 0x7472616b // 'trak'
     SrsMp4BoxTypeTKHD = 0x746b6864 // 'tkhd'
+    SrsMp4BoxTypeTREF = 0x74726566 // 'tref'
+    SrsMp4BoxTypeCHAP = 0x63686170 // 'chap'
     SrsMp4BoxTypeEDTS = 0x65647473 // 'edts'
     SrsMp4BoxTypeELST = 0x656c7374 // 'elst'
     SrsMp4BoxTypeMDIA = 0x6d646961 // 'mdia'
@@ -39,20 +43,116 @@ const (
     SrsMp4BoxTypeSTZ2 = 0x73747a32 // 'stz2'
     SrsMp4BoxTypeAVC1 = 0x61766331 // 'avc1'
     SrsMp4BoxTypeAVCC = 0x61766343 // 'avcC'
+    SrsMp4BoxTypeHVC1 = 0x68766331 // 'hvc1'
+    SrsMp4BoxTypeHEV1 = 0x68657631 // 'hev1'
+    SrsMp4BoxTypeHVCC = 0x68766343 // 'hvcC'
+    SrsMp4BoxTypeAV01 = 0x61763031 // 'av01'
+    SrsMp4BoxTypeAV1C = 0x61763143 // 'av1C'
+    SrsMp4BoxTypeVP09 = 0x76703039 // 'vp09'
+    SrsMp4BoxTypeVPCC = 0x76706343 // 'vpcC'
     SrsMp4BoxTypeMP4A = 0x6d703461 // 'mp4a'
     SrsMp4BoxTypeESDS = 0x65736473 // 'esds'
+    SrsMp4BoxTypeOPUS = 0x4f707573 // 'Opus'
+    SrsMp4BoxTypeDOPS = 0x644f7073 // 'dOps'
+    SrsMp4BoxTypeFLAC = 0x664c6143 // 'fLaC'
+    SrsMp4BoxTypeDFLA = 0x64664c61 // 'dfLa'
+    SrsMp4BoxTypeAC3 = 0x61632d33 // 'ac-3'
+    SrsMp4BoxTypeDAC3 = 0x64616333 // 'dac3'
+    SrsMp4BoxTypeEC3 = 0x65632d33 // 'ec-3'
+    SrsMp4BoxTypeDEC3 = 0x64656333 // 'dec3'
+    SrsMp4BoxTypeSOWT = 0x736f7774 // 'sowt'
+    SrsMp4BoxTypeTWOS = 0x74776f73 // 'twos'
+    SrsMp4BoxTypeLPCM = 0x6c70636d // 'lpcm'
+    SrsMp4BoxTypeIPCM = 0x6970636d // 'ipcm'
+    SrsMp4BoxTypePCMC = 0x70636d43 // 'pcmC'
+    SrsMp4BoxTypeALAW = 0x616c6177 // 'alaw'
+    SrsMp4BoxTypeULAW = 0x756c6177 // 'ulaw'
+    SrsMp4BoxTypeTEXT = 0x74657874 // 'text'
+    SrsMp4BoxTypeTX3G = 0x74783367 // 'tx3g'
+    SrsMp4BoxTypeWVTT = 0x77767474 // 'wvtt'
+    SrsMp4BoxTypeVTTCONFIG = 0x76747443 // 'vttC'
+    SrsMp4BoxTypeVTTCUE = 0x76747463 // 'vttc'
+    SrsMp4BoxTypeVTTEMPTY = 0x76747465 // 'vtte'
+    SrsMp4BoxTypePAYL = 0x7061796c // 'payl'
     SrsMp4BoxTypeUDTA = 0x75647461 // 'udta'
+    SrsMp4BoxTypeMETA = 0x6d657461 // 'meta'
+    SrsMp4BoxTypeILST = 0x696c7374 // 'ilst'
+    SrsMp4BoxTypeCHPL = 0x6368706c // 'chpl'
+    SrsMp4BoxTypeMVEX = 0x6d766578 // 'mvex'
+    SrsMp4BoxTypeTREX = 0x74726578 // 'trex'
+    SrsMp4BoxTypeMOOF = 0x6d6f6f66 // 'moof'
+    SrsMp4BoxTypeMFHD = 0x6d666864 // 'mfhd'
+    SrsMp4BoxTypeTRAF = 0x74726166 // 'traf'
+    SrsMp4BoxTypeTFHD = 0x74666864 // 'tfhd'
+    SrsMp4BoxTypeTFDT = 0x74666474 // 'tfdt'
+    SrsMp4BoxTypeTRUN = 0x7472756e // 'trun'
+    SrsMp4BoxTypeSTYP = 0x73747970 // 'styp'
+    SrsMp4BoxTypeSIDX = 0x73696478 // 'sidx'
 
     SrsMp4BoxBrandForbidden = 0x00
     SrsMp4BoxBrandISOM = 0x69736f6d // 'isom'
     SrsMp4BoxBrandISO2 = 0x69736f32 // 'iso2'
     SrsMp4BoxBrandAVC1 = 0x61766331 // 'avc1'
     SrsMp4BoxBrandMP41 = 0x6d703431 // 'mp41'
+    SrsMp4BoxBrandMP42 = 0x6d703432 // 'mp42'
+    SrsMp4BoxBrandISO5 = 0x69736f35 // 'iso5'
+    SrsMp4BoxBrandISO6 = 0x69736f36 // 'iso6'
+    SrsMp4BoxBrandDASH = 0x64617368 // 'dash'
+    SrsMp4BoxBrandMSDH = 0x6d736468 // 'msdh'
+    SrsMp4BoxBrandCMFC = 0x636d6663 // 'cmfc'
+    SrsMp4BoxBrandM4A = 0x4d344120 // 'M4A '
+    SrsMp4BoxBrandM4B = 0x4d344220 // 'M4B '
+    SrsMp4BoxBrandM4V = 0x4d345620 // 'M4V '
+    // The QuickTime movie, for example, the sowt/twos/lpcm audio and the chapter track.
+    SrsMp4BoxBrandQT = 0x71742020 // 'qt  '
 
     // The type of track, maybe combine of types.
     SrsMp4TrackTypeForbidden = 0x00
     SrsMp4TrackTypeAudio = 0x01
     SrsMp4TrackTypeVideo = 0x02
+    SrsMp4TrackTypeSubtitle = 0x04
+)
+
+type Mp4TrackType int
+
+// The name of track type, for user to select the track, for example, -vtrack for video.
+func (v Mp4TrackType) String() string {
+    switch v {
+    case SrsMp4TrackTypeAudio:
+        return "audio"
+    case SrsMp4TrackTypeVideo:
+        return "video"
+    case SrsMp4TrackTypeSubtitle:
+        return "subtitle"
+    }
+    return fmt.Sprintf("unknown(%v)", int(v))
+}
+
+/**
+ * The iTunes metadata in ilst, the item type is the FourCC where the © is 0xa9.
+ * The item contains a data atom, the free-form item also contains a mean and name atom.
+ */
+const (
+    SrsMp4IlstTypeName = 0xa96e616d // '©nam'
+    SrsMp4IlstTypeArtist = 0xa9415254 // '©ART'
+    SrsMp4IlstTypeAlbum = 0xa9616c62 // '©alb'
+    SrsMp4IlstTypeDay = 0xa9646179 // '©day'
+    SrsMp4IlstTypeTool = 0xa9746f6f // '©too'
+    SrsMp4IlstTypeDesc = 0x64657363 // 'desc'
+    SrsMp4IlstTypeCover = 0x636f7672 // 'covr'
+    SrsMp4IlstTypeFreeForm = 0x2d2d2d2d // '----'
+
+    SrsMp4IlstAtomData = 0x64617461 // 'data'
+    SrsMp4IlstAtomMean = 0x6d65616e // 'mean'
+    SrsMp4IlstAtomName = 0x6e616d65 // 'name'
+
+    // The well-known type of data atom.
+    SrsMp4IlstDataTypeBinary = 0
+    SrsMp4IlstDataTypeUTF8 = 1
+    SrsMp4IlstDataTypeJPEG = 13
+    SrsMp4IlstDataTypePNG = 14
+    SrsMp4IlstDataTypeSignedInt = 21
+    SrsMp4IlstDataTypeUnsignedInt = 22
 )
 
 /**
@@ -83,6 +183,47 @@ const (
     SrsVideoCodecIdOn2VP6WithAlphaChannel = 5
     SrsVideoCodecIdScreenVideoVersion2 = 6
     SrsVideoCodecIdAVC = 7
+    // The HEVC and later codecs are signaled by FourCC in enhanced RTMP, the id is only used internally.
+    SrsVideoCodecIdHEVC = 12
+    SrsVideoCodecIdAV1 = 13
+    SrsVideoCodecIdVP9 = 14
+)
+
+type VideoCodecId int
+
+// The FourCC of video codec in enhanced RTMP, zero for the legacy codecs.
+func (v VideoCodecId) FourCC() uint32 {
+    switch int(v) {
+    case SrsVideoCodecIdHEVC:
+        return SrsVideoFourCCHEVC
+    case SrsVideoCodecIdAV1:
+        return SrsVideoFourCCAV1
+    case SrsVideoCodecIdVP9:
+        return SrsVideoFourCCVP9
+    }
+    return 0
+}
+
+/**
+ * The video FourCC and packet type in enhanced RTMP.
+ * @doc enhanced-rtmp-v1.pdf, ExVideoTagHeader
+ * @see https://github.com/veovera/enhanced-rtmp
+ * IsExHeader UB[1], when set, the FrameType is UB[3], followed by VideoPacketType UB[4] and VideoFourCC UI32.
+ */
+const (
+    SrsVideoExHeader = 0x80
+
+    SrsVideoFourCCHEVC = 0x68766331 // 'hvc1'
+    SrsVideoFourCCAV1 = 0x61763031 // 'av01'
+    SrsVideoFourCCVP9 = 0x76703039 // 'vp09'
+
+    SrsVideoPacketTypeSequenceStart = 0
+    // For HEVC, with SI24 composition time offset.
+    SrsVideoPacketTypeCodedFrames = 1
+    SrsVideoPacketTypeSequenceEnd = 2
+    // For HEVC, the composition time offset is implied zero.
+    SrsVideoPacketTypeCodedFramesX = 3
+    SrsVideoPacketTypeMetadata = 4
 )
 
 /**
@@ -130,6 +271,73 @@ const (
     SrsAudioCodecIdSpeex = 11
     SrsAudioCodecIdReservedMP3_8kHz = 14
     SrsAudioCodecIdReservedDeviceSpecificSound = 15
+    // The Opus and later codecs are signaled by FourCC in enhanced RTMP, the id is only used internally.
+    SrsAudioCodecIdOpus = 18
+    SrsAudioCodecIdFLAC = 19
+    SrsAudioCodecIdAC3 = 20
+    SrsAudioCodecIdEAC3 = 21
+)
+
+type AudioCodecId int
+
+// The FourCC of audio codec in enhanced RTMP, zero for the legacy codecs.
+func (v AudioCodecId) FourCC() uint32 {
+    switch int(v) {
+    case SrsAudioCodecIdOpus:
+        return SrsAudioFourCCOpus
+    case SrsAudioCodecIdFLAC:
+        return SrsAudioFourCCFLAC
+    case SrsAudioCodecIdAC3:
+        return SrsAudioFourCCAC3
+    case SrsAudioCodecIdEAC3:
+        return SrsAudioFourCCEAC3
+    }
+    return 0
+}
+
+/**
+ * The formatSpecificFlags of QuickTime sound description version 2, for lpcm.
+ * @see Sound Sample Description (Version 2), QuickTime File Format Specification
+ */
+const (
+    SrsMp4LpcmFlagIsFloat = 0x01
+    SrsMp4LpcmFlagIsBigEndian = 0x02
+    SrsMp4LpcmFlagIsSignedInteger = 0x04
+)
+
+// The type of FLAC metadata block, the first block must be the STREAMINFO.
+// @see https://xiph.org/flac/format.html#metadata_block_header
+const (
+    SrsFlacMetadataTypeStreamInfo = 0
+)
+
+// The sample rate of fscod for AC-3 and E-AC-3, 3 is reserved.
+// @see 4.4.1.3 fscod, ETSI TS 102 366 V1.4.1, page 38
+var SrsAc3SampleRates = []uint32{48000, 44100, 32000}
+
+// The number of full bandwidth channels of acmod for AC-3 and E-AC-3, without LFE.
+// @see 4.4.2.3 acmod, ETSI TS 102 366 V1.4.1, page 40
+var SrsAc3Channels = []int{2, 1, 2, 3, 3, 4, 4, 5}
+
+/**
+ * The audio FourCC and packet type in enhanced RTMP.
+ * @doc enhanced-rtmp-v2.pdf, ExAudioTagHeader
+ * @see https://github.com/veovera/enhanced-rtmp
+ * The SoundFormat UB[4] is 9 for ExHeader, followed by AudioPacketType UB[4] and AudioFourCC UI32.
+ */
+const (
+    SrsAudioExHeader = 9
+
+    SrsAudioFourCCOpus = 0x4f707573 // 'Opus'
+    SrsAudioFourCCFLAC = 0x664c6143 // 'fLaC'
+    SrsAudioFourCCAC3 = 0x61632d33 // 'ac-3'
+    SrsAudioFourCCEAC3 = 0x65632d33 // 'ec-3'
+
+    SrsAudioPacketTypeSequenceStart = 0
+    SrsAudioPacketTypeCodedFrames = 1
+    SrsAudioPacketTypeSequenceEnd = 2
+    SrsAudioPacketTypeMultichannelConfig = 4
+    SrsAudioPacketTypeMultitrack = 5
 )
 
 /**
@@ -273,6 +481,39 @@ const (
     SrsAacProfileSSR = 2
 )
 
+/**
+ * the aac object type, for RTMP sequence header
+ * @see 1.5.1.1 Audio object type definition, ISO_IEC_14496-3-AAC-2001.pdf, page 23
+ */
+const (
+    SrsAacObjectTypeReserved = 0
+
+    SrsAacObjectTypeAacMain = 1
+    SrsAacObjectTypeAacLC = 2
+    SrsAacObjectTypeAacSSR = 3
+    SrsAacObjectTypeAacLTP = 4
+    // HE-AAC, the LC with SBR.
+    SrsAacObjectTypeAacHE = 5
+    SrsAacObjectTypeAacScalable = 6
+    SrsAacObjectTypeTwinVQ = 7
+    SrsAacObjectTypeErAacLC = 17
+    SrsAacObjectTypeErAacLTP = 19
+    SrsAacObjectTypeErAacScalable = 20
+    SrsAacObjectTypeErTwinVQ = 21
+    SrsAacObjectTypeErBSAC = 22
+    SrsAacObjectTypeErAacLD = 23
+    // HE-AACv2, the LC with SBR and PS.
+    SrsAacObjectTypeAacHEV2 = 29
+    // The escape value, the object type is 32 plus 6 bits.
+    SrsAacObjectTypeEscape = 31
+)
+
+// The sampling frequency of sampling_frequency_index, 0xf for explicit frequency.
+// @see 1.6.3.4 samplingFrequencyIndex, ISO_IEC_14496-3-AAC-2001.pdf, page 35
+var SrsAacSampleRates = []uint32{
+    96000, 88200, 64000, 48000, 44100, 32000, 24000, 22050, 16000, 12000, 11025, 8000, 7350,
+}
+
 /**
  * the level for avc/h.264.
  * @see Annex A Profiles and levels, ISO_IEC_14496-10-AVC-2003.pdf, page 207.
@@ -280,6 +521,7 @@ const (
 const (
     SrsAvcLevelReserved = 0
 
+    SrsAvcLevel_1b = 9
     SrsAvcLevel_1 = 10
     SrsAvcLevel_11 = 11
     SrsAvcLevel_12 = 12
@@ -292,8 +534,89 @@ const (
     SrsAvcLevel_32 = 32
     SrsAvcLevel_4 = 40
     SrsAvcLevel_41 = 41
+    SrsAvcLevel_42 = 42
     SrsAvcLevel_5 = 50
     SrsAvcLevel_51 = 51
+    SrsAvcLevel_52 = 52
+    SrsAvcLevel_6 = 60
+    SrsAvcLevel_61 = 61
+    SrsAvcLevel_62 = 62
+)
+
+type AvcLevel int
+
+// Whether the level_idc is defined in Annex A, the level 1b maybe 11 with constraint_set3_flag.
+func (v AvcLevel) IsValid() bool {
+    switch v {
+    case SrsAvcLevel_1, SrsAvcLevel_1b, SrsAvcLevel_11, SrsAvcLevel_12, SrsAvcLevel_13,
+        SrsAvcLevel_2, SrsAvcLevel_21, SrsAvcLevel_22, SrsAvcLevel_3, SrsAvcLevel_31, SrsAvcLevel_32,
+        SrsAvcLevel_4, SrsAvcLevel_41, SrsAvcLevel_42, SrsAvcLevel_5, SrsAvcLevel_51, SrsAvcLevel_52,
+        SrsAvcLevel_6, SrsAvcLevel_61, SrsAvcLevel_62:
+        return true
+    }
+    return false
+}
+
+func (v AvcLevel) String() string {
+    if v == SrsAvcLevel_1b {
+        return "1b"
+    }
+    if v % 10 == 0 {
+        return fmt.Sprintf("%v", int(v) / 10)
+    }
+    return fmt.Sprintf("%v.%v", int(v) / 10, int(v) % 10)
+}
+
+/**
+ * the profile for avc/h.264.
+ * @see Annex A Profiles and levels, ISO_IEC_14496-10-AVC-2003.pdf, page 205.
+ */
+const (
+    SrsAvcProfileReserved = 0
+
+    SrsAvcProfileBaseline = 66
+    SrsAvcProfileMain = 77
+    SrsAvcProfileExtended = 88
+    SrsAvcProfileHigh = 100
+    SrsAvcProfileHigh10 = 110
+    SrsAvcProfileHigh422 = 122
+    SrsAvcProfileHigh444 = 244
+    SrsAvcProfileCAVLC444 = 44
+)
+
+/**
+ * 8.8.3.1 Track Extends Box, the flags of tfhd.
+ * ISO_IEC_14496-12-base-format-2012.pdf, page 65
+ */
+const (
+    SrsMp4TfhdFlagsBaseDataOffset = 0x000001
+    SrsMp4TfhdFlagsSampleDescriptionIndex = 0x000002
+    SrsMp4TfhdFlagsDefaultSampleDuration = 0x000008
+    SrsMp4TfhdFlagsDefaultSampleSize = 0x000010
+    SrsMp4TfhdFlagsDefaultSampleFlags = 0x000020
+    SrsMp4TfhdFlagsDurationIsEmpty = 0x010000
+    SrsMp4TfhdFlagsDefaultBaseIsMoof = 0x020000
+)
+
+/**
+ * 8.8.8 Track Fragment Run Box, the flags of trun.
+ * ISO_IEC_14496-12-base-format-2012.pdf, page 69
+ */
+const (
+    SrsMp4TrunFlagsDataOffset = 0x000001
+    SrsMp4TrunFlagsFirstSampleFlags = 0x000004
+    SrsMp4TrunFlagsSampleDuration = 0x000100
+    SrsMp4TrunFlagsSampleSize = 0x000200
+    SrsMp4TrunFlagsSampleFlags = 0x000400
+    SrsMp4TrunFlagsSampleCtsOffset = 0x000800
+)
+
+/**
+ * 8.8.3.1 Track Extends Box, the sample_is_non_sync_sample bit of sample flags.
+ * ISO_IEC_14496-12-base-format-2012.pdf, page 65
+ */
+const (
+    SrsMp4SampleFlagsNonSync = 0x00010000
 )
 
 /**
@@ -305,6 +628,10 @@ const (
 
     SrsMp4HandlerTypeVIDE = 0x76696465 // 'vide'
     SrsMp4HandlerTypeSOUN = 0x736f756e // 'soun'
+    // The subtitle, sbtl for 3GPP timed text, subt for WebVTT, and text for QuickTime.
+    SrsMp4HandlerTypeSBTL = 0x7362746c // 'sbtl'
+    SrsMp4HandlerTypeSUBT = 0x73756274 // 'subt'
+    SrsMp4HandlerTypeTEXT = 0x74657874 // 'text'
 )
 
 // Table 1 — List of Class Tags for Descriptors
@@ -326,6 +653,10 @@ const (
     SrsMp4ObjectTypeForbidden = 0x00
     // Audio ISO/IEC 14496-3
     SrsMp4ObjectTypeAac = 0x40
+    // Audio ISO/IEC 13818-3, the MPEG-2 Layer III.
+    SrsMp4ObjectTypeMp3Mpeg2 = 0x69
+    // Audio ISO/IEC 11172-3, the MPEG-1 Layer III.
+    SrsMp4ObjectTypeMp3 = 0x6B
 )
 
 // Table 6 — streamType Values
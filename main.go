@@ -5,12 +5,28 @@ import (
     "fmt"
     "flag"
     "os"
+    "strings"
 )
 
 const (
     version string = "0.0.1"
 )
 
+// The metadata flags in key=value, can be specified multiple times.
+type metadataFlags []string
+
+func (v *metadataFlags) String() string {
+    return strings.Join(*v, ",")
+}
+
+func (v *metadataFlags) Set(value string) error {
+    if !strings.Contains(value, "=") {
+        return fmt.Errorf("metadata should be key=value, actual is %v", value)
+    }
+    *v = append(*v, value)
+    return nil
+}
+
 func main()  {
     ol.T(nil, fmt.Sprintf("mp4 to flv parser:%v, by panda of bravovcloud.com", version))
 
@@ -18,6 +34,23 @@ func main()  {
     flag.StringVar(&mp4Url, "i", "./test.mp4", "input mp4 file to be parsed")
     flag.StringVar(&flvUrl, "y", "./test.flv", "output flv file")
 
+    var vtrack, atrack uint
+    var vlang, alang, vname, aname string
+    var list, keyframes, tags, detectKeyframes bool
+    flag.UintVar(&vtrack, "vtrack", 0, "the video track id to convert, 0 for any")
+    flag.UintVar(&atrack, "atrack", 0, "the audio track id to convert, 0 for any")
+    flag.StringVar(&vlang, "vlang", "", "the video track language to convert, for example, eng")
+    flag.StringVar(&alang, "alang", "", "the audio track language to convert, for example, eng")
+    flag.StringVar(&vname, "vname", "", "the video track handler name to convert")
+    flag.StringVar(&aname, "aname", "", "the audio track handler name to convert")
+    flag.BoolVar(&list, "list", false, "list the tracks of input mp4 and quit")
+    flag.BoolVar(&keyframes, "keyframes", false, "write the keyframes index to metadata, for seeking in progressive flv")
+    flag.BoolVar(&detectKeyframes, "detectkeyframes", false, "detect the H.264 keyframes by NALUs, for the stss maybe missing or wrong")
+    flag.BoolVar(&tags, "tags", false, "write the iTunes metadata of mp4 to metadata, for example, the title")
+
+    var metadata metadataFlags
+    flag.Var(&metadata, "metadata", "set the metadata in key=value, for example, title=xxx or framerate=25, the empty value to remove the key")
+
     flag.Usage = func() {
         fmt.Fprintf(os.Stderr, "Usage of %s:\n", os.Args[0])
         flag.PrintDefaults()
@@ -28,6 +61,33 @@ func main()  {
     ol.T(nil, fmt.Sprintf("the input mp4 url is: %v, output flv is:%v", mp4Url, flvUrl))
 
     muxer := NewMuxer(mp4Url, flvUrl)
+
+    // List the tracks after moov parsed, never select the tracks or load the samples.
+    if list {
+        tracks, err := muxer.list()
+        if err != nil {
+            ol.E(nil, fmt.Sprintf("mux list tracks failed, err is %v", err))
+            return
+        }
+        for _, track := range tracks {
+            fmt.Println(track)
+        }
+        return
+    }
+
+    muxer.selectTracks(&Mp4TrackFilter{TrackId: uint32(vtrack), Language: vlang, HandlerName: vname},
+        &Mp4TrackFilter{TrackId: uint32(atrack), Language: alang, HandlerName: aname})
+    muxer.enableKeyframes(keyframes)
+    muxer.enableTags(tags)
+    muxer.enableDetectKeyframes(detectKeyframes)
+    for _, kv := range metadata {
+        // The empty value removes the key, for example, author=
+        if kvs := strings.SplitN(kv, "=", 2); kvs[1] == "" {
+            muxer.removeMetadata(kvs[0])
+        } else {
+            muxer.setMetadata(kvs[0], kvs[1])
+        }
+    }
     if err := muxer.init(); err != nil {
         ol.E(nil, fmt.Sprintf("mux init failed, err is %v", err))
         return
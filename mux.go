@@ -5,14 +5,36 @@ import (
     ol "github.com/ossrs/go-oryx-lib/logger"
     "fmt"
     "encoding/binary"
-    "bytes"
     "io"
+    "math"
+    "sort"
+    "strconv"
+
+    "github.com/panda1986/mp4_to_flv/amf0"
 )
 
 type Muxer struct {
     dec *Mp4Decoder
     mp4Url string
     flvUrl string
+
+    // Whether write the keyframes index and stat to metadata, for seeking in progressive flv.
+    keyframes bool
+    // The layout of flv tags, calc before muxing when keyframes enabled.
+    layout *FlvLayout
+
+    // Whether detect the H.264 keyframes by NALUs, not the stss.
+    detectKeyframes bool
+    // Whether forward the iTunes metadata of mp4 to onMetaData.
+    tags bool
+    // The script tags to interleave with samples by timestamp, for example, the onCuePoint.
+    scripts []*FlvScriptTag
+    // The index of next script tag to write.
+    scriptIndex int
+    // The user metadata, to add or override the properties of onMetaData.
+    metadata *amf0.EcmaArray
+    // The properties to remove from onMetaData.
+    removedMetadata map[string]bool
 }
 
 func NewMuxer(mp4, flv string) *Muxer {
@@ -20,10 +42,72 @@ func NewMuxer(mp4, flv string) *Muxer {
         dec: NewMp4Decoder(),
         mp4Url: mp4,
         flvUrl: flv,
+        metadata: amf0.NewEcmaArray(),
+        removedMetadata: make(map[string]bool),
     }
     return v
 }
 
+// Select the video and audio track to convert, the zero filter selects the first track.
+func (v *Muxer) selectTracks(vfilter, afilter *Mp4TrackFilter) {
+    v.dec.vfilter = vfilter
+    v.dec.afilter = afilter
+}
+
+// Enable to write the keyframes index to metadata, which need to calc the layout of flv first.
+func (v *Muxer) enableKeyframes(enabled bool) {
+    v.keyframes = enabled
+}
+
+// Enable to detect the H.264 keyframes by the IDR or non-IDR slices in samples.
+func (v *Muxer) enableDetectKeyframes(enabled bool) {
+    v.detectKeyframes = enabled
+}
+
+// Enable to forward the iTunes metadata of mp4, for example, the title and artist.
+func (v *Muxer) enableTags(enabled bool) {
+    v.tags = enabled
+}
+
+// Add or override the property of onMetaData, for example, the title, copyright or encoder.
+func (v *Muxer) setMetadata(name string, value interface{}) {
+    delete(v.removedMetadata, name)
+    v.metadata.Set(name, value)
+}
+
+// Convert the user metadata in string to the type of property it replaces, or parse the number
+// and boolean literals for new property, for example, width=1280 is number and stereo=true is boolean.
+func metadataValue(old, value interface{}) interface{} {
+    str, ok := value.(string)
+    if !ok {
+        return value
+    }
+
+    switch old.(type) {
+    case string:
+        return str
+    case bool:
+        if b, err := strconv.ParseBool(str); err == nil {
+            return b
+        }
+        return str
+    }
+
+    if str == "true" || str == "false" {
+        return str == "true"
+    }
+    if f, err := strconv.ParseFloat(str, 64); err == nil && !math.IsNaN(f) && !math.IsInf(f, 0) {
+        return f
+    }
+    return str
+}
+
+// Remove the property of onMetaData, including the properties generated by muxer.
+func (v *Muxer) removeMetadata(name string) {
+    v.metadata.Remove(name)
+    v.removedMetadata[name] = true
+}
+
 func (v *Muxer) init() (err error) {
     var f *os.File
     if f, err = os.Open(v.mp4Url); err != nil {
@@ -36,58 +120,113 @@ func (v *Muxer) init() (err error) {
         ol.E(nil, fmt.Sprintf("init mp4 decoder failed, err is %v", err))
         return
     }
+
+    if v.detectKeyframes && v.dec.hasVideo() {
+        if err = v.dec.detectKeyframes(v.mp4Url); err != nil {
+            ol.E(nil, fmt.Sprintf("detect keyframes failed, err is %v", err))
+            return
+        }
+    }
     ol.T(nil, fmt.Sprintf("dec:%+v", v.dec))
     return
 }
 
-func (v *Muxer) putAmfStringData(r io.Writer, data string) {
-    binary.Write(r, binary.BigEndian, uint16(len(data)))
-    binary.Write(r, binary.BigEndian, []byte(data))
-}
-
-func (v *Muxer) putAmfString(r io.Writer, data string) {
-    binary.Write(r, binary.BigEndian, uint8(AMF_DATA_TYPE_STRING))
-    v.putAmfStringData(r, data)
-}
+// List the tracks of mp4, only parse the boxes until moov, the tracks are not selected
+// and the samples are not loaded.
+func (v *Muxer) list() (tracks []*Mp4TrackInfo, err error) {
+    var f *os.File
+    if f, err = os.Open(v.mp4Url); err != nil {
+        ol.E(nil, fmt.Sprintf("open mp4 file failed, err is %v", err))
+        return
+    }
+    defer f.Close()
 
-func (v *Muxer) putAmfDouble(r io.Writer, data float64) {
-    binary.Write(r, binary.BigEndian, uint8(AMF_DATA_TYPE_NUMBER))
-    binary.Write(r, binary.BigEndian, data)
+    if err = v.dec.Probe(f); err != nil {
+        ol.E(nil, fmt.Sprintf("probe mp4 decoder failed, err is %v", err))
+        return
+    }
+    return v.dec.Tracks(), nil
 }
 
-func (v *Muxer) encodeMetadata() (data []byte) {
-    buf := new(bytes.Buffer)
-    v.putAmfString(buf, "onMetaData")
-
-    binary.Write(buf, binary.BigEndian, uint8(AMF_DATA_TYPE_ECMA_array))
-    binary.Write(buf, binary.BigEndian, uint32(8))
-    v.putAmfStringData(buf, "duration")
-    v.putAmfDouble(buf, v.dec.duration / 1000)
+// Build the properties of onMetaData, where the metaSize is the size of metadata tag data for layout.
+func (v *Muxer) buildMetadata(metaSize uint64) *amf0.EcmaArray {
+    // The properties of ECMA array, only for the tracks exist.
+    meta := amf0.NewEcmaArray()
+    meta.Set("duration", v.dec.duration / 1000)
+
+    if v.dec.hasVideo() {
+        meta.Set("width", v.dec.width)
+        meta.Set("height", v.dec.height)
+        // For enhanced RTMP, the codec id is the FourCC.
+        if fourCC := VideoCodecId(v.dec.vcodec).FourCC(); fourCC != 0 {
+            meta.Set("videocodecid", fourCC)
+        } else {
+            meta.Set("videocodecid", v.dec.vcodec)
+        }
+        if v.dec.vcodec == SrsVideoCodecIdAVC && v.dec.avcProfile != SrsAvcProfileReserved {
+            meta.Set("avcprofile", v.dec.avcProfile)
+            meta.Set("avclevel", v.dec.avcLevel)
+        }
+        if v.dec.frameRate > 0 {
+            meta.Set("framerate", v.dec.frameRate)
+        }
+    }
 
-    v.putAmfStringData(buf, "width")
-    v.putAmfDouble(buf, float64(v.dec.width))
+    if v.dec.hasAudio() {
+        meta.Set("audiosamplerate", v.dec.audioSampleRate)
+        meta.Set("audiosamplesize", AudioSoundBits(v.dec.soundBits).HumanRead())
+        meta.Set("audiochannels", v.dec.audioChannels)
+        meta.Set("stereo", v.dec.audioChannels >= 2)
+        // For enhanced RTMP, the codec id is the FourCC.
+        if fourCC := AudioCodecId(v.dec.acodec).FourCC(); fourCC != 0 {
+            meta.Set("audiocodecid", fourCC)
+        } else {
+            meta.Set("audiocodecid", v.dec.acodec)
+        }
+    }
 
-    v.putAmfStringData(buf, "height")
-    v.putAmfDouble(buf, float64(v.dec.height))
+    if v.layout != nil {
+        v.layout.setMetadata(meta, v.dec.duration / 1000, metaSize)
+    }
 
-    v.putAmfStringData(buf, "videocodecid")
-    v.putAmfDouble(buf, float64(v.dec.vcodec))
+    // The binary item such as cover is ignored, for AMF0 has no binary type.
+    if v.tags {
+        for _, item := range v.dec.Tags() {
+            if key, value := item.key(), item.value(); key != "" && value != nil {
+                meta.Set(key, value)
+            }
+        }
+    }
 
-    v.putAmfStringData(buf, "audiosamplerate")
-    sr := AudioSampleRate(v.dec.sampleRate).HumanRead()
-    v.putAmfDouble(buf, float64(sr)) // need to convert to real rate
+    // The user metadata is the last, to override or remove the properties.
+    for _, p := range v.metadata.Properties() {
+        old, _ := meta.Get(p.Name)
+        meta.Set(p.Name, metadataValue(old, p.Value))
+    }
+    for name := range v.removedMetadata {
+        meta.Remove(name)
+    }
 
-    v.putAmfStringData(buf, "author")
-    v.putAmfString(buf, "panda-mengxiaowei@bravocloud.com")
+    return meta
+}
 
-    v.putAmfStringData(buf, "audiosamplesize")
-    sb := AudioSoundBits(v.dec.soundBits).HumanRead()
-    v.putAmfDouble(buf, float64(sb)) // need to convert to read bits
+func (v *Muxer) encodeMetadata() (data []byte, err error) {
+    // The size of number is fixed, so we encode the metadata to get its size, which is
+    // required to calc the file positions of keyframes, then encode again.
+    var metaSize uint64
+    if v.layout != nil {
+        if data, err = amf0.Marshal("onMetaData", v.buildMetadata(0)); err != nil {
+            ol.E(nil, fmt.Sprintf("encode metadata failed, err is %v", err))
+            return
+        }
+        metaSize = uint64(len(data))
+    }
 
-    v.putAmfStringData(buf, "audiocodecid")
-    v.putAmfDouble(buf, float64(v.dec.acodec))
-    
-    return buf.Bytes()
+    if data, err = amf0.Marshal("onMetaData", v.buildMetadata(metaSize)); err != nil {
+        ol.E(nil, fmt.Sprintf("encode metadata failed, err is %v", err))
+        return
+    }
+    return
 }
 
 func (v *Muxer) mux() (err error) {
@@ -98,15 +237,27 @@ func (v *Muxer) mux() (err error) {
     }
     defer flv.Close()
 
+    if v.scripts, err = v.buildScripts(); err != nil {
+        ol.E(nil, fmt.Sprintf("build script tags failed, err is %v", err))
+        return
+    }
+
+    if v.keyframes {
+        if v.layout, err = v.calcLayout(); err != nil {
+            ol.E(nil, fmt.Sprintf("calc flv layout failed, err is %v", err))
+            return
+        }
+    }
+
     // FLV Header
     binary.Write(flv, binary.BigEndian, []byte("FLV"))
     binary.Write(flv, binary.BigEndian, uint8(1))
 
     var flag uint8
-    if v.dec.acodec != 0 {
+    if v.dec.hasAudio() {
         flag = flag | 0x04
     }
-    if v.dec.vcodec != 0 {
+    if v.dec.hasVideo() {
         flag = flag | 0x01
     }
     binary.Write(flv, binary.BigEndian, flag)
@@ -116,40 +267,155 @@ func (v *Muxer) mux() (err error) {
     binary.Write(flv, binary.BigEndian, uint32(0)) // first prev tag size
 
     // FLV metadata tag, type = 18
-    binary.Write(flv, binary.BigEndian, uint8(18))
-    // datasize 3 bytes
-    meta := v.encodeMetadata()
-    binary.Write(flv, binary.BigEndian, Uint32To3Bytes(uint32(len(meta))))
-    // timestamp 4 bytes
-    binary.Write(flv, binary.BigEndian, uint32(0))
-    // streamId 3 bytes
-    binary.Write(flv, binary.BigEndian, []byte{0, 0, 0})
-
-    binary.Write(flv, binary.BigEndian, meta)
+    var meta []byte
+    if meta, err = v.encodeMetadata(); err != nil {
+        return
+    }
+    v.writeTag(flv, SRS_RTMP_TYPE_SCRIPT, 0, meta)
 
-    binary.Write(flv, binary.BigEndian, uint32(len(meta) + 11)) // prev tag sze
     ol.T(nil, fmt.Sprint("start ingest mp4 to flv."))
     for {
         // Read a mp4 sample and convert to flv tag
         var s *SrsMp4Sample
         if s, err =v.readSample(); err != nil {
+            // The script tags after the last sample.
+            for _, tag := range v.nextScripts(math.MaxUint32) {
+                v.writeTag(flv, SRS_RTMP_TYPE_SCRIPT, tag.time, tag.data)
+            }
             return
         }
 
+        for _, tag := range v.nextScripts(s.dts) {
+            v.writeTag(flv, SRS_RTMP_TYPE_SCRIPT, tag.time, tag.data)
+        }
+
         tagType, time, data := v.sampleToFlvTag(s)
-        binary.Write(flv, binary.BigEndian, tagType)
-        binary.Write(flv, binary.BigEndian, Uint32To3Bytes(uint32(len(data))))
-        binary.Write(flv, binary.BigEndian, Uint32To3Bytes(time))
-        binary.Write(flv, binary.BigEndian, uint8(0))
-        binary.Write(flv, binary.BigEndian, []byte{0, 0, 0})
-        binary.Write(flv, binary.BigEndian, data)
-        binary.Write(flv, binary.BigEndian, uint32(len(data) + 11))
+        v.writeTag(flv, tagType, time, data)
         //ol.T(nil, fmt.Sprintf("tagType:%v, time:%v, len data=%v %x, len sample=%v", tagType, time, len(data), len(data), s.size()))
         // packet is ok.
     }
     return
 }
 
+/**
+ * Write the FLV tag and the previous tag size.
+ * E.4.1 FLV Tag, flv_v10_1.pdf, page 75
+ */
+func (v *Muxer) writeTag(w io.Writer, tagType uint8, time uint32, data []byte) {
+    binary.Write(w, binary.BigEndian, tagType)
+    // datasize 3 bytes
+    binary.Write(w, binary.BigEndian, Uint32To3Bytes(uint32(len(data))))
+    // timestamp 3 bytes, the upper 8 bits in TimestampExtended for timestamp over 0xffffff.
+    binary.Write(w, binary.BigEndian, Uint32To3Bytes(time))
+    binary.Write(w, binary.BigEndian, uint8(time >> 24))
+    // streamId 3 bytes
+    binary.Write(w, binary.BigEndian, []byte{0, 0, 0})
+
+    binary.Write(w, binary.BigEndian, data)
+
+    binary.Write(w, binary.BigEndian, uint32(len(data) + 11)) // prev tag size
+}
+
+/**
+ * The script tag to interleave with samples, the time is in milliseconds.
+ */
+type FlvScriptTag struct {
+    time uint32
+    data []byte
+}
+
+type FlvScriptTags []*FlvScriptTag
+
+func (v FlvScriptTags) Len() int {
+    return len(v)
+}
+
+func (v FlvScriptTags) Swap(i, j int) {
+    v[i], v[j] = v[j], v[i]
+}
+
+func (v FlvScriptTags) Less(i, j int) bool {
+    return v[i].time < v[j].time
+}
+
+// Get the script tags to write before the sample of dts, the tag is after the samples of same time,
+// so the sequence headers are always the first tags.
+func (v *Muxer) nextScripts(dts uint32) (tags []*FlvScriptTag) {
+    for ; v.scriptIndex < len(v.scripts) && v.scripts[v.scriptIndex].time < dts; v.scriptIndex++ {
+        tags = append(tags, v.scripts[v.scriptIndex])
+    }
+    return
+}
+
+/**
+ * Build the onCuePoint of navigation type for chapters, which is an object of the name,
+ * the time in seconds, the type and the parameters.
+ */
+func (v *Muxer) cuePoints() (tags []*FlvScriptTag, err error) {
+    var chapters []*Mp4Chapter
+    if chapters, err = v.dec.Chapters(v.mp4Url); err != nil {
+        return
+    }
+
+    for _, chapter := range chapters {
+        cue := amf0.NewObject()
+        cue.Set("name", chapter.title)
+        cue.Set("time", float64(chapter.time) / 1000)
+        cue.Set("type", "navigation")
+        cue.Set("parameters", amf0.NewObject())
+
+        var data []byte
+        if data, err = amf0.Marshal("onCuePoint", cue); err != nil {
+            return
+        }
+        tags = append(tags, &FlvScriptTag{time: chapter.time, data: data})
+    }
+
+    ol.T(nil, fmt.Sprintf("build %v cue points for chapters", len(tags)))
+    return
+}
+
+/**
+ * Build the onTextData for subtitles, which is an object of the text, the trackid and the language.
+ */
+func (v *Muxer) textData() (tags []*FlvScriptTag, err error) {
+    var subtitles []*Mp4Subtitle
+    if subtitles, err = v.dec.Subtitles(v.mp4Url); err != nil {
+        return
+    }
+
+    for _, subtitle := range subtitles {
+        text := amf0.NewObject()
+        text.Set("text", subtitle.text)
+        text.Set("trackid", subtitle.trackId)
+        text.Set("language", subtitle.language)
+
+        var data []byte
+        if data, err = amf0.Marshal("onTextData", text); err != nil {
+            return
+        }
+        tags = append(tags, &FlvScriptTag{time: subtitle.time, data: data})
+    }
+
+    ol.T(nil, fmt.Sprintf("build %v text data for subtitles", len(tags)))
+    return
+}
+
+// Build the script tags to interleave with samples, sort by timestamp.
+func (v *Muxer) buildScripts() (tags []*FlvScriptTag, err error) {
+    var cues, texts []*FlvScriptTag
+    if cues, err = v.cuePoints(); err != nil {
+        return
+    }
+    if texts, err = v.textData(); err != nil {
+        return
+    }
+
+    tags = append(cues, texts...)
+    sort.Stable(FlvScriptTags(tags))
+    return
+}
+
 /**
  * Read a sample form mp4.
  * @remark User can use srs_mp4_sample_to_flv_tag to convert mp4 sampel to flv tag.
@@ -161,8 +427,18 @@ func (v *Muxer) readSample() (s *SrsMp4Sample, err error) {
         return
     }
 
+    if err = v.fillSample(s); err != nil {
+        return nil, err
+    }
+
+    ol.I(nil, fmt.Sprintf("read a mp4 sample:%v", s))
+    return
+}
+
+// Fill the codec information of sample, from the decoder.
+func (v *Muxer) fillSample(s *SrsMp4Sample) (err error) {
     if s.handlerType == SrsMp4HandlerTypeForbidden {
-        return nil, fmt.Errorf("invalid mp4 handler")
+        return fmt.Errorf("invalid mp4 handler")
     }
 
     if s.handlerType == SrsMp4HandlerTypeSOUN {
@@ -173,11 +449,45 @@ func (v *Muxer) readSample() (s *SrsMp4Sample, err error) {
     } else {
         s.codec = uint16(v.dec.vcodec)
     }
-
-    ol.I(nil, fmt.Sprintf("read a mp4 sample:%v", s))
     return
 }
 
+/**
+ * Calc the layout of flv tags by the size of samples, without reading the payload.
+ * @remark The decoder is rewind to the first sample for muxing.
+ */
+func (v *Muxer) calcLayout() (layout *FlvLayout, err error) {
+    defer v.dec.rewind()
+    defer func() {
+        v.scriptIndex = 0
+    }()
+
+    layout = &FlvLayout{}
+    for {
+        var s *SrsMp4Sample
+        var ms *Mp4Sample
+        if s, ms, err = v.dec.nextSample(); err != nil {
+            // All samples are done.
+            break
+        }
+        if err = v.fillSample(s); err != nil {
+            return
+        }
+
+        for _, tag := range v.nextScripts(s.dts) {
+            layout.addScript(tag)
+        }
+        layout.addSample(s, ms == nil)
+    }
+
+    for _, tag := range v.nextScripts(math.MaxUint32) {
+        layout.addScript(tag)
+    }
+
+    ol.T(nil, fmt.Sprintf("flv layout, tags=%v bytes, %v keyframes", layout.tagsSize, len(layout.keyframePositions)))
+    return layout, nil
+}
+
 /**
  * Covert mp4 sample to flv tag.
  */
@@ -188,6 +498,14 @@ func (v *Muxer) sampleToFlvTag(s *SrsMp4Sample) (tagType uint8, time uint32, dat
     if s.handlerType == SrsMp4HandlerTypeSOUN {
         tagType = SRS_RTMP_TYPE_AUDIO
 
+        // The ExAudioTagHeader for enhanced RTMP, enhanced-rtmp-v2.pdf
+        if fourCC := AudioCodecId(s.codec).FourCC(); fourCC != 0 {
+            data = append(data, uint8(SrsAudioExHeader << 4) | s.audioPacketType())
+            data = append(data, uint8(fourCC >> 24), uint8(fourCC >> 16), uint8(fourCC >> 8), uint8(fourCC))
+            data = append(data, s.sample...)
+            return
+        }
+
         // E.4.2.1 AUDIODATA, flv_v10_1.pdf, page 3
         tmp := uint8(s.codec << 4) | uint8(s.sampleRate << 2) | uint8(s.soundBits << 1) | s.channels
         data = append(data, tmp)
@@ -202,18 +520,33 @@ func (v *Muxer) sampleToFlvTag(s *SrsMp4Sample) (tagType uint8, time uint32, dat
         return
     }
 
+    tagType = SRS_RTMP_TYPE_VIDEO
+
+    // The ExVideoTagHeader for enhanced RTMP, enhanced-rtmp-v1.pdf, page 7
+    if fourCC := VideoCodecId(s.codec).FourCC(); fourCC != 0 {
+        packetType := s.videoPacketType()
+        data = append(data, uint8(SrsVideoExHeader | s.frameType << 4 | uint16(packetType)))
+        data = append(data, uint8(fourCC >> 24), uint8(fourCC >> 16), uint8(fourCC >> 8), uint8(fourCC))
+        if s.codec == SrsVideoCodecIdHEVC && packetType == SrsVideoPacketTypeCodedFrames {
+            cts := int32(s.pts - s.dts)
+            data = append(data, to3Bytes(cts)...)
+        }
+        data = append(data, s.sample...)
+        return
+    }
+
     // E.4.3.1 VIDEODATA, flv_v10_1.pdf, page 5
     tmp := uint8(s.frameType << 4 | s.codec)
     data = append(data, tmp)
     if s.codec == SrsVideoCodecIdAVC {
-        tagType = SRS_RTMP_TYPE_VIDEO
         if s.frameTrait == SrsVideoAvcFrameTraitSequenceHeader {
             data = append(data, uint8(0))
         } else {
             data = append(data, uint8(1))
         }
-        // cts = pts - dts, where dts = flvheader->timestamp.
-        cts := s.pts - s.dts // TODO: may be cts = (s.pts - s.dts) /90;
+        // cts = pts - dts, where dts = flvheader->timestamp, both in ms.
+        // The cts maybe negative for ctts version 1, so it's signed.
+        cts := int32(s.pts - s.dts)
         data = append(data, to3Bytes(cts)...)
     }
 
@@ -266,17 +599,134 @@ func NewSrsMp4Smaple() *SrsMp4Sample {
  */
 func (v *SrsMp4Sample) size() uint32 {
     if v.handlerType == SrsMp4HandlerTypeSOUN {
+        if AudioCodecId(v.codec).FourCC() != 0 {
+            return v.nbSample + 5
+        }
         if v.codec == SrsAudioCodecIdAAC {
             return v.nbSample + 2
         }
         return v.nbSample + 1
     }
+    if VideoCodecId(v.codec).FourCC() != 0 {
+        if v.codec == SrsVideoCodecIdHEVC && v.videoPacketType() == SrsVideoPacketTypeCodedFrames {
+            return v.nbSample + 8
+        }
+        return v.nbSample + 5
+    }
     if v.codec == SrsVideoCodecIdAVC {
         return v.nbSample + 5
     }
     return v.nbSample + 1
 }
 
+/**
+ * The video packet type for enhanced RTMP.
+ */
+func (v *SrsMp4Sample) videoPacketType() uint8 {
+    if v.frameTrait == SrsVideoAvcFrameTraitSequenceHeader {
+        return SrsVideoPacketTypeSequenceStart
+    }
+    // For HEVC, the composition time offset is implied zero when omit.
+    if v.codec == SrsVideoCodecIdHEVC && v.pts == v.dts {
+        return SrsVideoPacketTypeCodedFramesX
+    }
+    return SrsVideoPacketTypeCodedFrames
+}
+
+/**
+ * The audio packet type for enhanced RTMP.
+ */
+func (v *SrsMp4Sample) audioPacketType() uint8 {
+    if v.frameTrait == SrsAudioAacFrameTraitSequenceHeader {
+        return SrsAudioPacketTypeSequenceStart
+    }
+    return SrsAudioPacketTypeCodedFrames
+}
+
 func (v *SrsMp4Sample) String() string {
     return fmt.Sprintf("ht:%v, dts:%v codec:%v, frameType:%v, sampleRate:%v, soundBits:%v, channels:%v, nb=%v", v.handlerType, v.dts, v.codec, v.frameType, v.sampleRate, v.soundBits, v.channels, v.nbSample)
-}
\ No newline at end of file
+}
+/**
+ * The layout of flv tags, for the keyframes index and stat in metadata.
+ */
+type FlvLayout struct {
+    // The size of tags after the metadata tag, including the previous tag size.
+    tagsSize uint64
+    // The number of video frames, not including the sequence header.
+    nbVideoFrames int
+    // The size of video and audio payload in bytes.
+    videoBytes uint64
+    audioBytes uint64
+    // The last timestamp of tags in milliseconds.
+    lastTimestamp uint32
+    // The positions of video keyframe tags, relative to the first tag after metadata.
+    keyframePositions []uint64
+    // The timestamp of video keyframe tags in milliseconds.
+    keyframeTimes []uint32
+}
+
+// Add a script tag, for example, the onCuePoint.
+func (v *FlvLayout) addScript(tag *FlvScriptTag) {
+    if tag.time > v.lastTimestamp {
+        v.lastTimestamp = tag.time
+    }
+    v.tagsSize += uint64(len(tag.data)) + 11 + 4
+}
+
+// Add a sample as flv tag, the sh is whether the sample is the sequence header.
+func (v *FlvLayout) addSample(s *SrsMp4Sample, sh bool) {
+    if s.handlerType == SrsMp4HandlerTypeVIDE && !sh {
+        v.nbVideoFrames++
+        v.videoBytes += uint64(s.nbSample)
+        if s.frameType == SrsVideoAvcFrameTypeKeyFrame {
+            v.keyframePositions = append(v.keyframePositions, v.tagsSize)
+            v.keyframeTimes = append(v.keyframeTimes, s.dts)
+        }
+    } else if s.handlerType == SrsMp4HandlerTypeSOUN && !sh {
+        v.audioBytes += uint64(s.nbSample)
+    }
+
+    if s.dts > v.lastTimestamp {
+        v.lastTimestamp = s.dts
+    }
+    // The tag header is 11 bytes, and 4 bytes previous tag size.
+    v.tagsSize += uint64(s.size()) + 11 + 4
+}
+
+/**
+ * Set the keyframes index and stat to metadata, where the duration is in seconds,
+ * and the metaSize is the size of metadata tag data.
+ */
+func (v *FlvLayout) setMetadata(meta *amf0.EcmaArray, duration float64, metaSize uint64) {
+    // The tags start after the flv header, the first previous tag size and the metadata tag.
+    base := 9 + 4 + 11 + metaSize + 4
+
+    meta.Set("filesize", base + v.tagsSize)
+    meta.Set("lasttimestamp", float64(v.lastTimestamp) / 1000)
+    if duration > 0 {
+        if v.nbVideoFrames > 0 {
+            // Prefer the frame rate in SPS, which is exact.
+            if _, ok := meta.Get("framerate"); !ok {
+                meta.Set("framerate", float64(v.nbVideoFrames) / duration)
+            }
+            meta.Set("videodatarate", float64(v.videoBytes) * 8 / 1000 / duration)
+        }
+        if v.audioBytes > 0 {
+            meta.Set("audiodatarate", float64(v.audioBytes) * 8 / 1000 / duration)
+        }
+    }
+
+    positions := make([]uint64, len(v.keyframePositions))
+    times := make([]float64, len(v.keyframeTimes))
+    for i, position := range v.keyframePositions {
+        positions[i] = base + position
+        times[i] = float64(v.keyframeTimes[i]) / 1000
+    }
+
+    keyframes := amf0.NewObject()
+    keyframes.Set("filepositions", positions)
+    keyframes.Set("times", times)
+
+    meta.Set("hasKeyframes", len(positions) > 0)
+    meta.Set("keyframes", keyframes)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+    "bytes"
+    "testing"
+)
+
+// Decode the timestamp of flv tag, the upper 8 bits are in TimestampExtended.
+func decodeTagTime(tag []byte) uint32 {
+    return uint32(tag[7]) << 24 | uint32(tag[4]) << 16 | uint32(tag[5]) << 8 | uint32(tag[6])
+}
+
+func TestMuxer_writeTagExtendedTimestamp(t *testing.T) {
+    v := &Muxer{}
+    for _, time := range []uint32{0, 0xffffff, 0x1000000, 28800000, 0xffffffff} {
+        var b bytes.Buffer
+        v.writeTag(&b, SRS_RTMP_TYPE_VIDEO, time, []byte{0x17, 0x01})
+
+        tag := b.Bytes()
+        if len(tag) != 11 + 2 + 4 {
+            t.Fatalf("time=%v, invalid tag size %v", time, len(tag))
+        }
+        if low := uint32(tag[4]) << 16 | uint32(tag[5]) << 8 | uint32(tag[6]); low != time & 0xffffff {
+            t.Errorf("time=%v, timestamp is %#x, expect %#x", time, low, time & 0xffffff)
+        }
+        if ext := tag[7]; ext != uint8(time >> 24) {
+            t.Errorf("time=%v, extended timestamp is %#x, expect %#x", time, ext, uint8(time >> 24))
+        }
+        if decoded := decodeTagTime(tag); decoded != time {
+            t.Errorf("decoded time is %v, expect %v", decoded, time)
+        }
+    }
+}
+
+func TestMuxer_sampleToFlvTagMultiHours(t *testing.T) {
+    v := &Muxer{}
+
+    // The video at 25fps and AAC at 48kHz for 10 hours, interleaved by dts.
+    var samples []*SrsMp4Sample
+    var vdts, adts float64
+    for vdts < 10 * 3600 * 1000 {
+        if adts < vdts {
+            s := NewSrsMp4Smaple()
+            s.handlerType = SrsMp4HandlerTypeSOUN
+            s.codec = SrsAudioCodecIdAAC
+            s.frameTrait = SrsAudioAacFrameTraitRawData
+            s.dts = uint32(adts)
+            samples = append(samples, s)
+            adts += 1024.0 * 1000 / 48000
+            continue
+        }
+
+        s := NewSrsMp4Smaple()
+        s.handlerType = SrsMp4HandlerTypeVIDE
+        s.codec = SrsVideoCodecIdAVC
+        s.frameTrait = SrsVideoAvcFrameTraitNALU
+        s.frameType = SrsVideoAvcFrameTypeInterFrame
+        s.dts, s.pts = uint32(vdts), uint32(vdts) + 80
+        samples = append(samples, s)
+        vdts += 40
+    }
+
+    var b bytes.Buffer
+    for _, s := range samples {
+        tagType, time, data := v.sampleToFlvTag(s)
+        v.writeTag(&b, tagType, time, data)
+    }
+
+    var previous uint32
+    var nbTags int
+    for tags := b.Bytes(); len(tags) > 0; nbTags++ {
+        size := int(tags[1]) << 16 | int(tags[2]) << 8 | int(tags[3])
+        time := decodeTagTime(tags)
+        if time < previous {
+            t.Fatalf("tag %v, time %v is less than previous %v", nbTags, time, previous)
+        }
+        if expect := samples[nbTags].dts; time != expect {
+            t.Fatalf("tag %v, time is %v, expect %v", nbTags, time, expect)
+        }
+        previous = time
+        tags = tags[11 + size + 4:]
+    }
+
+    if nbTags != len(samples) {
+        t.Errorf("decoded %v tags, expect %v", nbTags, len(samples))
+    }
+    if previous <= 0xffffff {
+        t.Errorf("last time %v should exceed %#x", previous, 0xffffff)
+    }
+}
+
+func TestMetadataValue(t *testing.T) {
+    for _, c := range []struct {
+        old, value, expect interface{}
+    }{
+        // The new property, parse the number and boolean literals.
+        {nil, "xxx", "xxx"},
+        {nil, "1280", float64(1280)},
+        {nil, "29.97", 29.97},
+        {nil, "true", true},
+        {nil, "false", false},
+        {nil, "NaN", "NaN"},
+        // Keep the type of property it replaces.
+        {"title", "2016", "2016"},
+        {uint32(720), "1080", float64(1080)},
+        {float64(25), "30", float64(30)},
+        {true, "0", false},
+        {false, "yes", "yes"},
+        // The value not in string.
+        {nil, 3, 3},
+    } {
+        if v := metadataValue(c.old, c.value); v != c.expect {
+            t.Errorf("old=%#v, value=%#v, got %#v, expect %#v", c.old, c.value, v, c.expect)
+        }
+    }
+}
+
+func TestMuxer_sampleToFlvTagNegativeCts(t *testing.T) {
+    v := &Muxer{}
+
+    // The pts is less than dts for ctts version 1.
+    s := NewSrsMp4Smaple()
+    s.handlerType = SrsMp4HandlerTypeVIDE
+    s.codec = SrsVideoCodecIdAVC
+    s.frameTrait = SrsVideoAvcFrameTraitNALU
+    s.frameType = SrsVideoAvcFrameTypeInterFrame
+    s.dts, s.pts = 1000, 960
+    s.sample = []byte{0, 0, 0, 1, 0x41}
+
+    _, time, data := v.sampleToFlvTag(s)
+    if time != 1000 {
+        t.Errorf("time is %v, expect 1000", time)
+    }
+    if !bytes.Equal(data[:5], []byte{0x27, 0x01, 0xff, 0xff, 0xd8}) {
+        t.Errorf("video tag header is %x", data[:5])
+    }
+    if cts := int32(uint32(data[2]) << 24 | uint32(data[3]) << 16 | uint32(data[4]) << 8) >> 8; cts != -40 {
+        t.Errorf("cts is %v, expect -40", cts)
+    }
+}
@@ -4,22 +4,29 @@ import (
     ol "github.com/ossrs/go-oryx-lib/logger"
     "fmt"
     "io"
+    "math"
+    "os"
     "reflect"
     "sort"
+    "strings"
 )
 
 // The sample struct of mp4.
 type Mp4Sample struct {
-    // The type of sample, audio or video.
+    // The type of sample, audio or video, or script for subtitle.
     sampleType int
+    // The track id in tkhd.
+    trackId uint32
     // The offset of sample in file.
-    offset uint32
+    offset uint64
     // The index of sample with a track, start from 0.
     index uint32
-    // The dts in tbn.
-    dts uint64
+    // The dts in tbn, maybe negative after the edit list applied.
+    dts int64
     // For video, the pts in tbn.
-    pts uint64
+    pts int64
+    // The duration in tbn, from stts.
+    duration uint32
     // The tbn(timebase).
     tbn uint32
     // For video, the frame type, whether keyframe.
@@ -41,33 +48,52 @@ func NewMp4Sample() *Mp4Sample {
 
 func (v *Mp4Sample) dts_ms() uint32 {
     if v.tbn > 0 {
-        return uint32(int32(v.dts * 1000 / uint64(v.tbn)) + v.adjust)
+        return uint32(int32(v.dts * 1000 / int64(v.tbn)) + v.adjust)
     }
     return 0
 }
 
 func (v *Mp4Sample) pts_ms() uint32 {
     if v.tbn > 0 {
-        return uint32(int32(v.pts * 1000 / uint64(v.tbn)) + v.adjust)
+        return uint32(int32(v.pts * 1000 / int64(v.tbn)) + v.adjust)
     }
     return 0
 }
 
 type Mp4SampleManager struct {
     samples []*Mp4Sample
+    // The samples of subtitle tracks, sort by dts, which are written as script tags.
+    subtitles []*Mp4Sample
+    // Whether any track has an edit list, which defines the A/V sync.
+    hasEdits bool
+    // The base of timestamps in baseTbn, which is the minimum dts of A/V samples, to make the
+    // timestamps of all tracks start from zero.
+    base int64
+    baseTbn uint32
 }
 
 func NewMp4SampleManager() *Mp4SampleManager {
     v := &Mp4SampleManager{
         samples: []*Mp4Sample{},
+        subtitles: []*Mp4Sample{},
     }
     return v
 }
 
-func (v *Mp4SampleManager) load_trak(frameType int, track *Mp4TrackBox) (tses []*Mp4Sample, err error) {
+// Load the samples of track, where the movieTimeScale is the timescale of mvhd for edit list.
+func (v *Mp4SampleManager) load_trak(frameType int, track *Mp4TrackBox, movieTimeScale uint32) (tses []*Mp4Sample, err error) {
+    if tses, err = v.load_stbl(frameType, track); err != nil {
+        return
+    }
+    return v.apply_edits(track, tses, movieTimeScale), nil
+}
+
+// Load the samples in stbl of track, the edit list is not applied.
+func (v *Mp4SampleManager) load_stbl(frameType int, track *Mp4TrackBox) (tses []*Mp4Sample, err error) {
     var mdhd *Mp4MediaHeaderBox
     var stco *Mp4ChunkOffsetBox
-    var stsz *Mp4SampleSizeBox
+    var co64 *Mp4ChunkLargeOffsetBox
+    var stsz Mp4SampleSizeTable
     var stsc *Mp4Sample2ChunkBox
     var stts *Mp4DecodingTime2SampleBox
     var ctts *Mp4CompositionTime2SampleBox
@@ -78,11 +104,21 @@ func (v *Mp4SampleManager) load_trak(frameType int, track *Mp4TrackBox) (tses []
     if mdhd, err = track.mdhd(); err != nil {
         return
     }
-    if stco, err = track.stco(); err != nil {
+    var tkhd *Mp4TrackHeaderBox
+    if tkhd, err = track.tkhd(); err != nil {
         return
     }
+    // The chunk offsets are in stco, or co64 for files larger than 4GB.
+    if stco, err = track.stco(); err != nil {
+        if co64, err = track.co64(); err != nil {
+            return
+        }
+    }
+    // The sample sizes are in stsz, or the compact stz2.
     if stsz, err = track.stsz(); err != nil {
-        return
+        if stsz, err = track.stz2(); err != nil {
+            return
+        }
     }
     if stsc, err = track.stsc(); err != nil {
         return
@@ -110,10 +146,24 @@ func (v *Mp4SampleManager) load_trak(frameType int, track *Mp4TrackBox) (tses []
 
     var previous *Mp4Sample
 
+    var nbChunks uint32
+    if stco != nil {
+        nbChunks = stco.EntryCount
+    } else {
+        nbChunks = co64.EntryCount
+    }
+
     var ci uint32
-    for ci = 0; ci < stco.EntryCount; ci ++ {
+    for ci = 0; ci < nbChunks; ci ++ {
         // The sample offset relative in chunk.
-        var sample_relative_offset uint32
+        var sample_relative_offset uint64
+
+        var chunkOffset uint64
+        if stco != nil {
+            chunkOffset = uint64(stco.Entries[ci])
+        } else {
+            chunkOffset = co64.Entries[ci]
+        }
 
         // Find how many samples from stsc.
         entry := stsc.onChunk(ci)
@@ -122,33 +172,36 @@ func (v *Mp4SampleManager) load_trak(frameType int, track *Mp4TrackBox) (tses []
         for i = 0; i < entry.SamplesPerChunk; i ++ {
             sample := NewMp4Sample()
             sample.sampleType = frameType
+            sample.trackId = tkhd.TrackId
             if previous != nil {
                 sample.index = previous.index + 1
             }
             sample.tbn = mdhd.TimeScale
-            sample.offset = stco.Entries[ci] + sample_relative_offset
+            sample.offset = chunkOffset + sample_relative_offset
 
             var sampleSize uint32
             if sampleSize, err = stsz.getSampleSize(sample.index); err != nil {
                 return
             }
-            sample_relative_offset += sampleSize
+            sample_relative_offset += uint64(sampleSize)
 
             var sttsEntry *Mp4SttsEntry
             if sttsEntry, err = stts.on_sample(sample.index); err != nil {
                 return
             }
+            // The dts is the sum of durations of previous samples.
             if previous != nil {
-                sample.dts = previous.dts + uint64(sttsEntry.sampleDelta)
+                sample.dts = previous.dts + int64(previous.duration)
                 sample.pts = sample.dts
             }
+            sample.duration = sttsEntry.sampleDelta
 
             var cttsEntry *Mp4CttsEntry
             if ctts != nil {
                 if cttsEntry, err = ctts.on_sample(sample.index); err != nil {
                     return
                 }
-                sample.pts = sample.dts + uint64(cttsEntry.sampleOffset)
+                sample.pts = sample.dts + cttsEntry.sampleOffset
             }
 
             if frameType == SrsFrameTypeVideo {
@@ -168,39 +221,332 @@ func (v *Mp4SampleManager) load_trak(frameType int, track *Mp4TrackBox) (tses []
     }
     ol.T(nil, fmt.Sprintf("total samples:%v", len(tses)))
 
-    if previous != nil && previous.index + 1 != stsz.sampleCount {
-        err = fmt.Errorf("MP4 illegal samples count, exp=%v, actual=%v", stsz.sampleCount, previous.index + 1)
+    if previous != nil && previous.index + 1 != stsz.getSampleCount() {
+        err = fmt.Errorf("MP4 illegal samples count, exp=%v, actual=%v", stsz.getSampleCount(), previous.index + 1)
         return
     }
+    return
+}
+
+// Apply the edit list of track to the samples, the empty edits insert the initial delay,
+// and the first media edit shifts the timestamps and drops the samples before it.
+// @remark Only the first media edit is applied, others are ignored.
+func (v *Mp4SampleManager) apply_edits(track *Mp4TrackBox, tses []*Mp4Sample, movieTimeScale uint32) []*Mp4Sample {
+    elst, err := track.elst()
+    if err != nil || len(tses) == 0 || movieTimeScale == 0 {
+        return tses
+    }
+    // The edits of subtitle never affect the A/V sync.
+    if tses[0].sampleType != SrsFrameTypeScript {
+        v.hasEdits = true
+    }
+
+    tbn := int64(tses[0].tbn)
+    var delay int64
+    var mediaTime int64
+    for _, entry := range elst.entries {
+        if entry.mediaTime == -1 {
+            delay += int64(entry.segmentDuration) * tbn / int64(movieTimeScale)
+            continue
+        }
+        mediaTime = entry.mediaTime
+        break
+    }
+    ol.T(nil, fmt.Sprintf("apply elst, delay=%v, media time=%v, tbn=%v", delay, mediaTime, tbn))
+
+    // For video, the last keyframe before the edit is required to decode, so never drop it.
+    var keep int
+    for k, ts := range tses {
+        if ts.sampleType == SrsFrameTypeVideo && ts.frameType == SrsVideoAvcFrameTypeKeyFrame && ts.pts <= mediaTime {
+            keep = k
+        }
+    }
 
+    edited := []*Mp4Sample{}
+    for k, ts := range tses {
+        if ts.pts + int64(ts.duration) <= mediaTime && (ts.sampleType != SrsFrameTypeVideo || k < keep) {
+            continue
+        }
+        ts.dts = ts.dts - mediaTime + delay
+        ts.pts = ts.pts - mediaTime + delay
+        edited = append(edited, ts)
+    }
+    ol.T(nil, fmt.Sprintf("apply elst ok, drop %v samples", len(tses) - len(edited)))
+    return edited
+}
+
+// Load the samples of video, audio and subtitle tracks, either A/V track maybe nil.
+func (v *Mp4SampleManager) do_load(moov *Mp4MovieBox, vide, soun *Mp4TrackBox, subtitles []*Mp4TrackBox) (stss []*Mp4Sample, err error) {
+    var mvhd *Mp4MovieHeaderBox
+    if mvhd, err = moov.Mvhd(); err != nil {
+        return
+    }
+
+    stss = []*Mp4Sample{}
+    if vide != nil {
+        var vstss []*Mp4Sample
+        if vstss, err = v.load_trak(SrsFrameTypeVideo, vide, mvhd.TimeScale); err != nil {
+            return
+        }
+        ol.T(nil, fmt.Sprintf("load video trak ok, stss len=%v", len(vstss)))
+        stss = append(stss, vstss...)
+    }
+
+    if soun != nil {
+        var astss []*Mp4Sample
+        if astss, err = v.load_trak(SrsFrameTypeAudio, soun, mvhd.TimeScale); err != nil {
+            return
+        }
+        ol.T(nil, fmt.Sprintf("load audio trak ok, stss len=%v", len(astss)))
+        stss = append(stss, astss...)
+    }
+
+    for _, subtitle := range subtitles {
+        var tstss []*Mp4Sample
+        // The subtitles are optional, so ignore the broken track.
+        if tstss, err = v.load_trak(SrsFrameTypeScript, subtitle, mvhd.TimeScale); err != nil {
+            ol.W(nil, fmt.Sprintf("ignore subtitle %v, load failed, err is %v", subtitle.Info(), err))
+            err = nil
+            continue
+        }
+        ol.T(nil, fmt.Sprintf("load subtitle trak ok, stss len=%v", len(tstss)))
+        stss = append(stss, tstss...)
+    }
+
+    ol.T(nil, fmt.Sprintf("load trak ok, stss len=%v", len(stss)))
     return
 }
 
-func (v *Mp4SampleManager) do_load(moov *Mp4MovieBox) (stss []*Mp4Sample, err error) {
-    var vide *Mp4TrackBox
-    if vide, err = moov.Video(); err != nil {
+// The track to load from the movie fragments.
+type Mp4FragmentTrack struct {
+    frameType int
+    trackId uint32
+    track *Mp4TrackBox
+    // The defaults for fragments, optional.
+    trex *Mp4TrackExtendsBox
+    tbn uint32
+    // The dts of next sample, for fragment without tfdt.
+    dts int64
+    samples []*Mp4Sample
+    // Whether any traf of track is broken, only for the optional subtitles.
+    broken bool
+}
+
+func NewMp4FragmentTrack(frameType int, track *Mp4TrackBox, mvex *Mp4MovieExtendsBox) (v *Mp4FragmentTrack, err error) {
+    v = &Mp4FragmentTrack{
+        frameType: frameType,
+        track: track,
+        samples: []*Mp4Sample{},
+    }
+
+    var mdhd *Mp4MediaHeaderBox
+    if mdhd, err = track.mdhd(); err != nil {
         return
     }
-    var vstss []*Mp4Sample
-    if vstss, err = v.load_trak(SrsFrameTypeVideo, vide); err != nil {
+    v.tbn = mdhd.TimeScale
+
+    var tkhd *Mp4TrackHeaderBox
+    if tkhd, err = track.tkhd(); err != nil {
         return
     }
-    ol.T(nil, fmt.Sprintf("load video trak ok, stss len=%v", len(vstss)))
+    v.trackId = tkhd.TrackId
+    v.trex, _ = mvex.trex(tkhd.TrackId)
+    return
+}
 
-    var soun *Mp4TrackBox
-    if soun, err = moov.Audio(); err != nil {
+// Load the samples in traf, where base is the base data offset if not specified by tfhd.
+// @return The end of sample data, which is the base of next traf.
+func (v *Mp4FragmentTrack) load_traf(traf *Mp4TrackFragmentBox, tfhd *Mp4TrackFragmentHeaderBox, moofPos uint64, base uint64) (end uint64, err error) {
+    if (tfhd.Flags & SrsMp4TfhdFlagsBaseDataOffset) != 0 {
+        base = tfhd.baseDataOffset
+    } else if (tfhd.Flags & SrsMp4TfhdFlagsDefaultBaseIsMoof) != 0 {
+        base = moofPos
+    }
+
+    if tfdt, err := traf.tfdt(); err == nil {
+        v.dts = int64(tfdt.baseMediaDecodeTime)
+    }
+
+    // The defaults from tfhd, or trex.
+    var defaultDuration, defaultSize, defaultFlags uint32
+    if v.trex != nil {
+        defaultDuration = v.trex.defaultSampleDuration
+        defaultSize = v.trex.defaultSampleSize
+        defaultFlags = v.trex.defaultSampleFlags
+    }
+    if (tfhd.Flags & SrsMp4TfhdFlagsDefaultSampleDuration) != 0 {
+        defaultDuration = tfhd.defaultSampleDuration
+    }
+    if (tfhd.Flags & SrsMp4TfhdFlagsDefaultSampleSize) != 0 {
+        defaultSize = tfhd.defaultSampleSize
+    }
+    if (tfhd.Flags & SrsMp4TfhdFlagsDefaultSampleFlags) != 0 {
+        defaultFlags = tfhd.defaultSampleFlags
+    }
+
+    // The first trun starts from the base, others follow the previous trun.
+    offset := base
+    for _, trun := range traf.truns() {
+        if (trun.Flags & SrsMp4TrunFlagsDataOffset) != 0 {
+            offset = uint64(int64(base) + int64(trun.dataOffset))
+        }
+
+        for i, entry := range trun.entries {
+            sample := NewMp4Sample()
+            sample.sampleType = v.frameType
+            sample.trackId = v.trackId
+            sample.index = uint32(len(v.samples))
+            sample.tbn = v.tbn
+            sample.offset = offset
+
+            sample.duration = defaultDuration
+            if (trun.Flags & SrsMp4TrunFlagsSampleDuration) != 0 {
+                sample.duration = entry.sampleDuration
+            }
+
+            sample.nbData = defaultSize
+            if (trun.Flags & SrsMp4TrunFlagsSampleSize) != 0 {
+                sample.nbData = entry.sampleSize
+            }
+
+            flags := defaultFlags
+            if (trun.Flags & SrsMp4TrunFlagsSampleFlags) != 0 {
+                flags = entry.sampleFlags
+            } else if i == 0 && (trun.Flags & SrsMp4TrunFlagsFirstSampleFlags) != 0 {
+                flags = trun.firstSampleFlags
+            }
+
+            sample.dts = v.dts
+            sample.pts = sample.dts
+            if (trun.Flags & SrsMp4TrunFlagsSampleCtsOffset) != 0 {
+                sample.pts = sample.dts + entry.sampleCompositionTimeOffset
+            }
+
+            if v.frameType == SrsFrameTypeVideo {
+                if (flags & SrsMp4SampleFlagsNonSync) == 0 {
+                    sample.frameType = SrsVideoAvcFrameTypeKeyFrame
+                } else {
+                    sample.frameType = SrsVideoAvcFrameTypeInterFrame
+                }
+            }
+
+            v.dts += int64(sample.duration)
+            offset += uint64(sample.nbData)
+            v.samples = append(v.samples, sample)
+            ol.I(nil, fmt.Sprintf("...load one fragment sample:%+v", sample))
+        }
+    }
+
+    end = offset
+    return
+}
+
+func (v *Mp4SampleManager) do_load_fragments(moov *Mp4MovieBox, moofs []*Mp4MovieFragmentBox, vide, soun *Mp4TrackBox, subtitles []*Mp4TrackBox) (stss []*Mp4Sample, err error) {
+    var mvhd *Mp4MovieHeaderBox
+    if mvhd, err = moov.Mvhd(); err != nil {
         return
     }
-    var astss []*Mp4Sample
-    if astss, err = v.load_trak(SrsFrameTypeAudio, soun); err != nil {
+
+    var mvex *Mp4MovieExtendsBox
+    if mvex, err = moov.Mvex(); err != nil {
         return
     }
-    ol.T(nil, fmt.Sprintf("load audio trak ok, stss len=%v", len(astss)))
+
+    // The fragment tracks, key is the track id.
+    tracks := map[uint32]*Mp4FragmentTrack{}
+    fts := []*Mp4FragmentTrack{}
+
+    for _, trak := range append([]*Mp4TrackBox{vide, soun}, subtitles...) {
+        if trak == nil {
+            continue
+        }
+
+        frameType := SrsFrameTypeScript
+        if trak == vide {
+            frameType = SrsFrameTypeVideo
+        } else if trak == soun {
+            frameType = SrsFrameTypeAudio
+        }
+
+        var ft *Mp4FragmentTrack
+        if ft, err = NewMp4FragmentTrack(frameType, trak, mvex); err != nil {
+            // The subtitles are optional, so ignore the broken track.
+            if frameType == SrsFrameTypeScript {
+                ol.W(nil, fmt.Sprintf("ignore subtitle %v, load failed, err is %v", trak.Info(), err))
+                err = nil
+                continue
+            }
+            return
+        }
+
+        // The samples in moov are before the fragments, and the fragments without tfdt follow them.
+        if nb := trak.nbSamples(); nb > 0 {
+            ol.W(nil, fmt.Sprintf("track %v has %v samples in moov and %v moofs, load moov samples first", ft.trackId, nb, len(moofs)))
+            if ft.samples, err = v.load_stbl(frameType, trak); err != nil {
+                if frameType != SrsFrameTypeScript {
+                    return
+                }
+                ol.W(nil, fmt.Sprintf("ignore subtitle %v, load failed, err is %v", trak.Info(), err))
+                err = nil
+                continue
+            }
+            if len(ft.samples) > 0 {
+                last := ft.samples[len(ft.samples) - 1]
+                ft.dts = last.dts + int64(last.duration)
+            }
+        }
+
+        tracks[ft.trackId] = ft
+        fts = append(fts, ft)
+    }
+
+    for _, moof := range moofs {
+        // The base data offset of first traf is the moof, the next is the end of previous traf.
+        moofPos := uint64(moof.StartPos)
+        base := moofPos
+
+        for _, box := range moof.Boxes {
+            traf, ok := box.(*Mp4TrackFragmentBox)
+            if !ok {
+                continue
+            }
+
+            var tfhd *Mp4TrackFragmentHeaderBox
+            if tfhd, err = traf.tfhd(); err != nil {
+                return
+            }
+
+            ft, ok := tracks[tfhd.trackId]
+            if !ok {
+                ol.W(nil, fmt.Sprintf("ignore traf of track %v", tfhd.trackId))
+                continue
+            }
+
+            var next uint64
+            if next, err = ft.load_traf(traf, tfhd, moofPos, base); err != nil {
+                if ft.frameType != SrsFrameTypeScript {
+                    return
+                }
+                // The subtitles are optional, so ignore the track with broken traf.
+                ol.W(nil, fmt.Sprintf("ignore subtitle %v, load traf failed, err is %v", ft.track.Info(), err))
+                delete(tracks, tfhd.trackId)
+                ft.samples, ft.broken, err = nil, true, nil
+                continue
+            }
+            base = next
+        }
+    }
 
     stss = []*Mp4Sample{}
-    stss = append(stss, vstss...)
-    stss = append(stss, astss...)
-    ol.T(nil, fmt.Sprintf("load trak ok, stss len=%v", len(stss)))
+    for _, ft := range fts {
+        if ft.broken {
+            continue
+        }
+        tses := v.apply_edits(ft.track, ft.samples, mvhd.TimeScale)
+        ol.T(nil, fmt.Sprintf("load fragment trak ok, type=%v, stss len=%v", ft.frameType, len(tses)))
+        stss = append(stss, tses...)
+    }
+    ol.T(nil, fmt.Sprintf("load fragments ok, moofs=%v, stss len=%v", len(moofs), len(stss)))
     return
 }
 
@@ -215,19 +561,131 @@ func (v SortMp4Samples) Swap(i, j int) {
 }
 
 func (v SortMp4Samples) Less(i, j int) bool {
-    return int(v[i].offset) > int(v[j].offset)
+    return v[i].offset > v[j].offset
+}
+
+type SortMp4SamplesByDts []*Mp4Sample
+
+func (v SortMp4SamplesByDts) Len() int {
+    return len(v)
+}
+
+func (v SortMp4SamplesByDts) Swap(i, j int) {
+    v[i], v[j] = v[j], v[i]
+}
+
+func (v SortMp4SamplesByDts) Less(i, j int) bool {
+    return v[i].dts_ms() < v[j].dts_ms()
 }
 
 // Load the samples from moov. There must be atleast one track.
-func (v *Mp4SampleManager) load(moov *Mp4MovieBox) (err error) {
+func (v *Mp4SampleManager) load(moov *Mp4MovieBox, vide, soun *Mp4TrackBox, subtitles []*Mp4TrackBox) (err error) {
     var tses []*Mp4Sample
-    if tses, err = v.do_load(moov); err != nil {
+    if tses, err = v.do_load(moov, vide, soun, subtitles); err != nil {
         return
     }
+    return v.build(tses)
+}
+
+// Load the samples from the movie fragments, for fragmented mp4.
+func (v *Mp4SampleManager) load_fragments(moov *Mp4MovieBox, moofs []*Mp4MovieFragmentBox, vide, soun *Mp4TrackBox, subtitles []*Mp4TrackBox) (err error) {
+    var tses []*Mp4Sample
+    if tses, err = v.do_load_fragments(moov, moofs, vide, soun, subtitles); err != nil {
+        return
+    }
+    return v.build(tses)
+}
+
+// Get the duration of A/V samples in milliseconds, which is the end of last sample,
+// the dts plus duration, minus the dts of first sample.
+func (v *Mp4SampleManager) duration() float64 {
+    if len(v.samples) == 0 {
+        return 0
+    }
+
+    start, end := math.MaxFloat64, float64(0)
+    for _, ts := range v.samples {
+        dts := float64(ts.dts_ms())
+        start = math.Min(start, dts)
+        if ts.tbn > 0 {
+            end = math.Max(end, dts + float64(ts.duration) * 1000 / float64(ts.tbn))
+        }
+    }
+    return math.Max(end - start, 0)
+}
+
+// Get the base of timestamps in tbn, the integer part is converted first to avoid overflow.
+func (v *Mp4SampleManager) offset(tbn uint32) int64 {
+    if v.baseTbn == 0 {
+        return 0
+    }
+    q, r := v.base / int64(v.baseTbn), v.base % int64(v.baseTbn)
+    return q * int64(tbn) + r * int64(tbn) / int64(v.baseTbn)
+}
+
+// Get the timestamp in milliseconds rebased with A/V, where the timestamp is in tbn,
+// and the timestamp before A/V starts from zero.
+func (v *Mp4SampleManager) rebase_ms(ts int64, tbn uint32) uint32 {
+    if tbn == 0 {
+        return 0
+    }
+    if ts -= v.offset(tbn); ts < 0 {
+        return 0
+    }
+    return uint32(ts * 1000 / int64(tbn))
+}
+
+// Build the samples of all tracks, sort by offset and adjust the timestamps.
+func (v *Mp4SampleManager) build(all []*Mp4Sample) (err error) {
+    // The subtitles are written as script tags by timestamp, not in the samples of A/V.
+    tses := []*Mp4Sample{}
+    for _, ts := range all {
+        if ts.sampleType == SrsFrameTypeScript {
+            v.subtitles = append(v.subtitles, ts)
+        } else {
+            tses = append(tses, ts)
+        }
+    }
+    sort.Stable(SortMp4SamplesByDts(v.subtitles))
+
+    if len(tses) == 0 {
+        return fmt.Errorf("MP4 no samples")
+    }
 
     // sort dict to slice
     sort.Sort(sort.Reverse(SortMp4Samples(tses)))
     ol.T(nil, fmt.Sprintf("after sort, tses len=%v, first=%+v", len(tses), tses[0]))
+
+    // The timestamps maybe start from negative for the edit list, for example, the B-frames or AAC
+    // priming, or from a large tfdt of fragments, for example, the CMAF segments or the epoch based
+    // tfdt, so rebase all tracks in the tbn of each track, to start from zero and keep the A/V sync.
+    first := tses[0]
+    for _, ts := range tses {
+        if ts.tbn > 0 && (first.tbn == 0 || float64(ts.dts) / float64(ts.tbn) < float64(first.dts) / float64(first.tbn)) {
+            first = ts
+        }
+    }
+    v.base, v.baseTbn = first.dts, first.tbn
+    for _, ts := range tses {
+        offset := v.offset(ts.tbn)
+        ts.dts, ts.pts = ts.dts - offset, ts.pts - offset
+    }
+    // The subtitles are in the same timeline, the subtitle before A/V starts from zero.
+    for _, ts := range v.subtitles {
+        offset := v.offset(ts.tbn)
+        ts.dts, ts.pts = ts.dts - offset, ts.pts - offset
+        if ts.dts < 0 {
+            ts.dts, ts.pts = 0, 0
+        }
+    }
+    ol.T(nil, fmt.Sprintf("rebase timestamps by %v in tbn %v", v.base, v.baseTbn))
+
+    // The edit list defines the A/V sync, so never adjust it.
+    if v.hasEdits {
+        v.samples = append(v.samples, tses...)
+        return
+    }
+
     // Dumps temp samples.
     // Adjust the sequence diff.
     var maxp int32
@@ -257,7 +715,7 @@ func (v *Mp4SampleManager) load(moov *Mp4MovieBox) (err error) {
     if maxp * maxn == 0  && maxp + maxn != 0 {
         for _, ts := range tses {
             if ts.sampleType == SrsFrameTypeAudio {
-                ts.adjust = 0 - maxp - maxn
+                ts.adjust += 0 - maxp - maxn
             }
         }
     }
@@ -272,8 +730,17 @@ func (v *Mp4SampleManager) load(moov *Mp4MovieBox) (err error) {
 type Mp4Decoder struct {
     // The major brand of decoder, parse from ftyp.
     brand uint32
-    // The samples build from moov.
+    // The samples build from moov, or moof for fragmented mp4.
     samples *Mp4SampleManager
+    // The moov and moofs, the samples of fragmented mp4 are built when all moofs parsed.
+    moov *Mp4MovieBox
+    moofs []*Mp4MovieFragmentBox
+    // The video and audio track to convert, nil if no such track.
+    vide *Mp4TrackBox
+    soun *Mp4TrackBox
+    // The filter to select the video and audio track.
+    vfilter *Mp4TrackFilter
+    afilter *Mp4TrackFilter
     // The current written sample information.
     curIndex uint32
     // The video codec of first track, generally there is zero or one track.
@@ -285,9 +752,18 @@ type Mp4Decoder struct {
     height uint16
 
     // For H.264/AVC, the avcc contains the sps/pps.
+    // For H.265/HEVC, the hvcc contains the vps/sps/pps.
+    // For AV1, the av1c contains the sequence header OBU.
+    // For VP9, the vpcc contains the profile, level and color config.
     pavcc []uint8
     // Whether avcc is written to reader.
     avccWritten bool
+    // For H.264/AVC, the profile, level, chroma format and frame rate from avcC and SPS.
+    // The frame rate is 0 if no VUI timing info.
+    avcProfile int
+    avcLevel int
+    chromaFormat int
+    frameRate float64
 
     // The audio codec of first track, generally there is zero or one track.
     // Forbidden if no audio stream.
@@ -298,30 +774,72 @@ type Mp4Decoder struct {
     soundBits int
     // The audio sound type.
     channels int
+    // The actual sample rate in Hz and the number of channels, for the flags of
+    // AAC are always 44kHz and stereo.
+    audioSampleRate uint32
+    audioChannels int
+    // For PCM, whether the 16 bits samples are big-endian, or the 8 bits samples are signed,
+    // which should be converted to little-endian or unsigned for FLV.
+    pcmBigEndian bool
+    pcmSigned bool
 
     // For AAC, the asc in esds box.
     pasc []uint8
     // Whether asc is written to reader.
     ascWritten bool
+
+    // The iTunes metadata in udta, for example, the title and artist.
+    tags []*Mp4IlstItem
+
+    // The chapters, in the Nero chpl of udta, or the QuickTime chapter text track.
+    chpl *Mp4ChapterListBox
+    chapterTrack *Mp4TrackBox
+
+    // The subtitle tracks, for example, tx3g or wvtt, the chapter track is excluded.
+    subtitles []*Mp4TrackBox
+}
+
+// The subtitle of mp4, the time is in milliseconds.
+type Mp4Subtitle struct {
+    time uint32
+    text string
+    trackId uint32
+    // The ISO-639-2/T language code, for example, eng.
+    language string
+}
+
+// The chapter of mp4, the time is in milliseconds.
+type Mp4Chapter struct {
+    time uint32
+    title string
 }
 
 func NewMp4Decoder() *Mp4Decoder {
     v := &Mp4Decoder{
+        vcodec: SrsVideoCodecIdForbidden,
+        acodec: SrsAudioCodecIdForbidden,
         pavcc: []uint8{},
         pasc: []uint8{},
         samples: NewMp4SampleManager(),
+        moofs: []*Mp4MovieFragmentBox{},
+        vfilter: &Mp4TrackFilter{},
+        afilter: &Mp4TrackFilter{},
     }
     return v
 }
 
 func (v *Mp4Decoder) Init(r io.Reader) (err error) {
+    // The position of box in file, for the data offset of moof.
+    var pos uint64
     for {
         mb := NewMp4Box()
         var box Box
-        if box, err = mb.discovery(r); err != nil {
+        if box, err = mb.discoveryTopLevel(r); err != nil {
             ol.E(nil, fmt.Sprintf("discovery box failed, err is %v", err))
             break
         }
+        box.Basic().StartPos = int(pos)
+        pos += box.Basic().sz()
 
         ol.T(nil, fmt.Sprintf("main discover and decode a box, type:%v", reflect.TypeOf(box)))
 
@@ -346,10 +864,18 @@ func (v *Mp4Decoder) Init(r io.Reader) (err error) {
                 ol.E(nil, fmt.Sprintf("parse moov failed, err is %v", err))
                 return
             }
+        } else if fbox, ok := box.(*Mp4MovieFragmentBox); ok {
+            v.moofs = append(v.moofs, fbox)
         }
     }
 
     if err == io.EOF {
+        if v.moov != nil && v.moov.Fragmented() {
+            if err = v.parseMoofs(); err != nil {
+                ol.E(nil, fmt.Sprintf("parse moofs failed, err is %v", err))
+                return
+            }
+        }
         ol.T(nil, "init mp4 decoder success")
         return nil
     }
@@ -357,10 +883,61 @@ func (v *Mp4Decoder) Init(r io.Reader) (err error) {
     return
 }
 
+// Parse the boxes until moov, only for the information of tracks, the samples are not loaded.
+func (v *Mp4Decoder) Probe(r io.Reader) (err error) {
+    for {
+        mb := NewMp4Box()
+        var box Box
+        if box, err = mb.discoveryTopLevel(r); err != nil {
+            if err == io.EOF {
+                err = fmt.Errorf("can't find moov box")
+            }
+            ol.E(nil, fmt.Sprintf("discovery box failed, err is %v", err))
+            return
+        }
+
+        if err = box.DecodeHeader(r); err != nil {
+            ol.E(nil, fmt.Sprintf("mp4 decode contained box header failed, err is %v", err))
+            return
+        }
+
+        if err = box.Basic().DecodeBoxes(r); err != nil {
+            ol.E(nil, fmt.Sprintf("mp4 decode contained box boxes failed, err is %v", err))
+            return
+        }
+
+        if fbox, ok := box.(*Mp4FileTypeBox); ok {
+            if err = v.parseFtyp(fbox); err != nil {
+                ol.E(nil, fmt.Sprintf("parse ftyp failed, err is %v", err))
+                return
+            }
+        } else if fbox, ok := box.(*Mp4MovieBox); ok {
+            v.moov = fbox
+            ol.T(nil, "probe mp4 decoder success")
+            return
+        }
+    }
+}
+
 func (v *Mp4Decoder) parseFtyp(box *Mp4FileTypeBox) (err error) {
-    legalBrands := map[uint32]struct{}{SrsMp4BoxBrandISO2: {}, SrsMp4BoxBrandAVC1:{}, SrsMp4BoxBrandISOM:{}, SrsMp4BoxBrandMP41:{ }}
-    if _, ok := legalBrands[box.majorBrand]; !ok {
-        err = fmt.Errorf("Mp4 brand is illegal, brand=%v", box.majorBrand)
+    legalBrands := map[uint32]struct{}{SrsMp4BoxBrandISO2: {}, SrsMp4BoxBrandAVC1:{}, SrsMp4BoxBrandISOM:{}, SrsMp4BoxBrandMP41:{ },
+        SrsMp4BoxBrandMP42: {}, SrsMp4BoxBrandISO5: {}, SrsMp4BoxBrandISO6: {}, SrsMp4BoxBrandDASH: {}, SrsMp4BoxBrandMSDH: {}, SrsMp4BoxBrandCMFC: {},
+        SrsMp4BoxBrandM4A: {}, SrsMp4BoxBrandM4B: {}, SrsMp4BoxBrandM4V: {}, SrsMp4BoxBrandQT: {}}
+
+    // The file is legal when the major brand or any compatible brand is legal.
+    legal := false
+    for _, brand := range append([]uint32{box.majorBrand}, box.compatibleBrands...) {
+        if _, ok := legalBrands[brand]; ok {
+            legal = true
+            break
+        }
+    }
+    if !legal {
+        var compatibles []string
+        for _, brand := range box.compatibleBrands {
+            compatibles = append(compatibles, fourCCString(brand))
+        }
+        err = fmt.Errorf("Mp4 brand is illegal, brand=%v, compatible=[%v]", fourCCString(box.majorBrand), strings.Join(compatibles, ","))
         ol.E(nil, err.Error())
         return
     }
@@ -377,17 +954,77 @@ func (v *Mp4Decoder) parseMoov(moov *Mp4MovieBox) (err error) {
         return
     }
     v.duration = float64(mvhd.Duration())
+    v.moov = moov
+
+    for _, track := range moov.Tracks() {
+        ol.T(nil, fmt.Sprintf("mp4 %v", track.Info()))
+    }
+
+    // The iTunes metadata is optional.
+    if ilst, err := moov.Ilst(); err == nil {
+        v.tags = ilst.items
+        for _, item := range v.tags {
+            ol.T(nil, fmt.Sprintf("mp4 tag %v", item))
+        }
+    }
+
+    // The chapters are optional, prefer the Nero chpl.
+    if chpl, err := moov.Chpl(); err == nil {
+        v.chpl = chpl
+    } else {
+        v.chapterTrack = v.findChapterTrack(moov)
+    }
 
-    var vide *Mp4TrackBox
-    if vide, err = moov.Video(); err != nil {
+    // The subtitle tracks are optional, but never the chapter track.
+    for _, track := range moov.Tracks() {
+        if track.trackType() == SrsMp4TrackTypeSubtitle && !v.isChapterTrack(moov, track) {
+            v.subtitles = append(v.subtitles, track)
+            ol.T(nil, fmt.Sprintf("mp4 subtitle %v", track.Info()))
+        }
+    }
+
+    // Either video or audio track is optional, but there must be one.
+    // When user specifies the filter, the track must exist.
+    v.vide, err = moov.SelectTrack(SrsMp4TrackTypeVideo, v.vfilter)
+    if err != nil && *v.vfilter != (Mp4TrackFilter{}) {
+        return
+    }
+    v.soun, err = moov.SelectTrack(SrsMp4TrackTypeAudio, v.afilter)
+    if err != nil && *v.afilter != (Mp4TrackFilter{}) {
         return
     }
+    err = nil
 
-    var soun *Mp4TrackBox
-    if soun, err = moov.Audio(); err != nil {
+    if v.vide == nil && v.soun == nil {
+        err = fmt.Errorf("can't find video or audio trak box in moov")
+        ol.E(nil, err.Error())
         return
     }
 
+    if v.vide != nil {
+        if err = v.parseVideo(v.vide); err != nil {
+            return
+        }
+    }
+
+    if v.soun != nil {
+        if err = v.parseAudio(v.soun); err != nil {
+            return
+        }
+    }
+
+    // build the samples structure from moov, for fragmented mp4, build when all moofs parsed.
+    if !moov.Fragmented() {
+        if err = v.samples.load(moov, v.vide, v.soun, v.subtitles); err != nil {
+            return
+        }
+    }
+
+    ol.T(nil, fmt.Sprintf("dur=%v ms, vide=%v(%v, %v BSH),soun=%v(%v,%v BSH),%v,%v,%v", mvhd.Duration(), moov.NbVideoTracks(), v.vcodec, len(v.pavcc), moov.NbSoundTracks(), v.acodec, len(v.pasc), v.channels, v.soundBits, v.sampleRate))
+    return
+}
+
+func (v *Mp4Decoder) parseVideo(vide *Mp4TrackBox) (err error) {
     var avc1 *Mp4VisualSampleEntry
     if avc1, err = vide.avc1(); err != nil {
         return
@@ -395,12 +1032,78 @@ func (v *Mp4Decoder) parseMoov(moov *Mp4MovieBox) (err error) {
     v.width = avc1.Width
     v.height = avc1.Height
 
+    // The video sequence header, avcC for AVC, hvcC for HEVC, av1C for AV1, vpcC for VP9.
+    v.vcodec = vide.vide_codec()
+    switch v.vcodec {
+    case SrsVideoCodecIdHEVC:
+        var hvcc *Mp4HvccBox
+        if hvcc, err = vide.hvcc(); err != nil {
+            return
+        }
+        v.pavcc = append(v.pavcc, hvcc.hevcConfig...)
+    case SrsVideoCodecIdAV1:
+        var av1c *Mp4Av1cBox
+        if av1c, err = vide.av1c(); err != nil {
+            return
+        }
+        v.pavcc = append(v.pavcc, av1c.av1Config...)
+    case SrsVideoCodecIdVP9:
+        var vpcc *Mp4VpccBox
+        if vpcc, err = vide.vpcc(); err != nil {
+            return
+        }
+        v.pavcc = append(v.pavcc, vpcc.vpConfig...)
+    default:
+        var avcc *Mp4AvccBox
+        if avcc, err = vide.avcc(); err != nil {
+            return
+        }
+        v.pavcc = append(v.pavcc, avcc.avcConfig...)
+
+        // The size of avc1 maybe not the coded size, so we use the size in SPS.
+        if err := v.parseAvcc(avcc); err != nil {
+            ol.W(nil, fmt.Sprintf("ignore avcc parse failed, use %vx%v of avc1, err is %v", v.width, v.height, err))
+        }
+    }
+    return
+}
+
+func (v *Mp4Decoder) parseAvcc(avcc *Mp4AvccBox) (err error) {
+    var record *AvcDecoderConfigurationRecord
+    if record, err = avcc.record(); err != nil {
+        return
+    }
+    if len(record.spss) == 0 {
+        return fmt.Errorf("no sps in avcc")
+    }
+
+    sps := NewAvcSps()
+    if err = sps.Decode(record.spss[0]); err != nil {
+        return
+    }
+
+    if !AvcLevel(sps.levelIdc).IsValid() {
+        ol.W(nil, fmt.Sprintf("invalid avc level %v, profile is %v", sps.levelIdc, sps.profileIdc))
+    }
+    if sps.width != uint32(v.width) || sps.height != uint32(v.height) {
+        ol.W(nil, fmt.Sprintf("avc1 size %vx%v mismatch sps %vx%v, use sps", v.width, v.height, sps.width, sps.height))
+    }
+
+    v.width, v.height = uint16(sps.width), uint16(sps.height)
+    v.avcProfile, v.avcLevel = int(sps.profileIdc), int(sps.levelIdc)
+    v.chromaFormat, v.frameRate = int(sps.chromaFormatIdc), sps.frameRate
+    ol.T(nil, fmt.Sprintf("avc profile=%v, level=%v, size=%vx%v, chroma=%v, fps=%.2f", v.avcProfile,
+        AvcLevel(v.avcLevel), v.width, v.height, v.chromaFormat, v.frameRate))
+    return
+}
+
+func (v *Mp4Decoder) parseAudio(soun *Mp4TrackBox) (err error) {
     var mp4a *Mp4AudioSampleEntry
     if mp4a, err = soun.mp4a(); err != nil {
         return
     }
 
-    sr := mp4a.sampleRate >> 16
+    sr := mp4a.rate()
     if sr >= 44100 {
         v.sampleRate = SrsAudioSampleRate44100
     } else if sr >= 22050 {
@@ -423,27 +1126,372 @@ func (v *Mp4Decoder) parseMoov(moov *Mp4MovieBox) (err error) {
         v.channels = SrsAudioChannelsMono
     }
 
-    var avcc *Mp4AvccBox
-    if avcc, err = vide.avcc(); err != nil {
+    v.acodec = soun.soun_codec()
+    v.audioSampleRate, v.audioChannels = sr, int(mp4a.channelCount)
+
+    switch v.acodec {
+    case SrsAudioCodecIdOpus:
+        return v.parseOpus(mp4a)
+    case SrsAudioCodecIdFLAC:
+        return v.parseFlac(mp4a)
+    case SrsAudioCodecIdAC3, SrsAudioCodecIdEAC3:
+        return v.parseAc3(mp4a)
+    case SrsAudioCodecIdLinearPCMLittleEndian:
+        return v.parsePcm(mp4a)
+    case SrsAudioCodecIdReservedG711AlawLogarithmicPCM, SrsAudioCodecIdReservedG711MuLawLogarithmicPCM:
+        // For G.711, the sample is 8 bits, and the FLV player always plays at 8kHz.
+        if sr != 8000 {
+            return fmt.Errorf("g711 requires 8000Hz, actual is %vHz", sr)
+        }
+        return
+    case SrsAudioCodecIdMP3:
+        // For MP3, there is no sequence header, and the flags are from mp4a, for the FLV tag
+        // has no 48kHz, the frame header of MP3 has the actual sample rate.
         return
     }
+
     var asc *Mp4DecoderSpecificInfo
     if asc, err = soun.asc(); err != nil {
         return
     }
+    v.pasc = append(v.pasc, asc.asc...)
 
-    v.vcodec = vide.vide_codec()
-    v.acodec = soun.soun_codec()
+    // The sample rate and channels of mp4a maybe wrong, for example, the HE-AAC.
+    if err := v.parseAsc(asc.asc); err != nil {
+        ol.W(nil, fmt.Sprintf("ignore asc parse failed, use %vHz %v channels of mp4a, err is %v", sr, mp4a.channelCount, err))
+    }
 
-    v.pavcc = append(v.pavcc, avcc.avcConfig...)
-    v.pasc = append(v.pasc, asc.asc...)
+    // @see E.4.2.1 AUDIODATA, video_file_format_spec_v10_1.pdf, page 77
+    // For AAC, the SoundRate is always 3 and the SoundType is always 1.
+    v.sampleRate = SrsAudioSampleRate44100
+    v.channels = SrsAudioChannelsStereo
+    return
+}
 
-    if err = v.samples.load(moov); err != nil {
+// For Opus, the sequence header is the OpusHead, and the output sample rate is always 48kHz.
+func (v *Mp4Decoder) parseOpus(mp4a *Mp4AudioSampleEntry) (err error) {
+    var dOps *Mp4OpusSpecificBox
+    if dOps, err = mp4a.dOps(); err != nil {
         return
     }
-    // build the samples structure from moov
 
-    ol.T(nil, fmt.Sprintf("dur=%v ms, vide=%v(%v, %v BSH),soun=%v(%v,%v BSH),%v,%v,%v", mvhd.Duration(), moov.NbVideoTracks(), v.vcodec, len(v.pavcc), moov.NbSoundTracks(), v.acodec, len(v.pasc), v.channels, v.soundBits, v.sampleRate))
+    v.pasc = append(v.pasc, dOps.opusHead()...)
+    v.audioSampleRate, v.audioChannels = 48000, int(dOps.outputChannelCount)
+    return
+}
+
+// For FLAC, the sequence header is the fLaC marker and metadata blocks, the STREAMINFO
+// has the actual sample rate, for the mp4a maybe zero when larger than 65535Hz.
+func (v *Mp4Decoder) parseFlac(mp4a *Mp4AudioSampleEntry) (err error) {
+    var dfLa *Mp4FlacSpecificBox
+    if dfLa, err = mp4a.dfLa(); err != nil {
+        return
+    }
+
+    v.pasc = append(v.pasc, dfLa.flacHeader()...)
+    v.audioSampleRate, v.audioChannels = dfLa.sampleRate, int(dfLa.channels)
+    if dfLa.bitsPerSample > 8 {
+        v.soundBits = SrsAudioSampleBits16bit
+    }
+    return
+}
+
+// For AC-3 and E-AC-3, there is no sequence header, for the sync frame is self-contained,
+// the dac3 and dec3 has the actual sample rate and channels.
+func (v *Mp4Decoder) parseAc3(mp4a *Mp4AudioSampleEntry) (err error) {
+    if v.acodec == SrsAudioCodecIdAC3 {
+        var dac3 *Mp4AC3SpecificBox
+        if dac3, err = mp4a.dac3(); err != nil {
+            return
+        }
+        v.audioSampleRate, v.audioChannels = dac3.sampleRate(), dac3.channels()
+    } else {
+        var dec3 *Mp4EC3SpecificBox
+        if dec3, err = mp4a.dec3(); err != nil {
+            return
+        }
+        v.audioSampleRate, v.audioChannels = dec3.sampleRate(), dec3.channels()
+    }
+    return
+}
+
+/**
+ * For PCM, the FLV requires 8 bits unsigned or 16 bits signed little-endian, so we
+ * detect the format of sample entry, to convert the samples when read.
+ * @see E.4.2.1 AUDIODATA, video_file_format_spec_v10_1.pdf, page 77
+ */
+func (v *Mp4Decoder) parsePcm(mp4a *Mp4AudioSampleEntry) (err error) {
+    bits, bigEndian, signed := int(mp4a.sampleSize), false, true
+    switch mp4a.Basic().BoxType {
+    case SrsMp4BoxTypeTWOS:
+        bigEndian = true
+    case SrsMp4BoxTypeLPCM:
+        if mp4a.version != 2 {
+            return fmt.Errorf("lpcm requires sound description version 2, actual is %v", mp4a.version)
+        }
+        if mp4a.formatSpecificFlags & SrsMp4LpcmFlagIsFloat == SrsMp4LpcmFlagIsFloat {
+            return fmt.Errorf("float lpcm is not supported")
+        }
+        bigEndian = mp4a.formatSpecificFlags & SrsMp4LpcmFlagIsBigEndian == SrsMp4LpcmFlagIsBigEndian
+        signed = mp4a.formatSpecificFlags & SrsMp4LpcmFlagIsSignedInteger == SrsMp4LpcmFlagIsSignedInteger
+    case SrsMp4BoxTypeIPCM:
+        var pcmC *Mp4PcmConfigBox
+        if pcmC, err = mp4a.pcmC(); err != nil {
+            return
+        }
+        bits, bigEndian = int(pcmC.sampleSize), !pcmC.littleEndian()
+    }
+
+    if bits != 8 && bits != 16 {
+        return fmt.Errorf("pcm %v bits is not supported", bits)
+    }
+    // The SoundRate is the playback rate of PCM, so it must be exactly one of the FLV rates.
+    switch mp4a.rate() {
+    case 5512, 11025, 22050, 44100:
+    default:
+        return fmt.Errorf("pcm %vHz is not supported, should be 5512, 11025, 22050 or 44100Hz", mp4a.rate())
+    }
+    if mp4a.channelCount > 2 {
+        return fmt.Errorf("pcm %v channels is not supported", mp4a.channelCount)
+    }
+
+    // The byte order is only for 16 bits, and the sign is only for 8 bits.
+    if bits == 16 {
+        v.soundBits = SrsAudioSampleBits16bit
+        v.pcmBigEndian = bigEndian
+    } else {
+        v.soundBits = SrsAudioSampleBits8bit
+        v.pcmSigned = signed
+    }
+    ol.T(nil, fmt.Sprintf("pcm %v bits, big endian=%v, signed=%v", bits, bigEndian, signed))
+    return
+}
+
+func (v *Mp4Decoder) parseAsc(data []uint8) (err error) {
+    asc := NewAacAudioSpecificConfig()
+    if err = asc.Decode(data); err != nil {
+        return
+    }
+    if asc.SampleRate() == 0 || asc.Channels() == 0 {
+        return fmt.Errorf("invalid asc rate=%v, channels=%v", asc.SampleRate(), asc.Channels())
+    }
+
+    v.audioSampleRate, v.audioChannels = asc.SampleRate(), asc.Channels()
+    ol.T(nil, fmt.Sprintf("aac object=%v, rate=%v, channels=%v, sbr=%v, ps=%v", asc.objectType,
+        v.audioSampleRate, v.audioChannels, asc.sbr, asc.ps))
+    return
+}
+
+// Get the information of all tracks, user can select the track by it.
+func (v *Mp4Decoder) Tracks() (tracks []*Mp4TrackInfo) {
+    if v.moov == nil {
+        return
+    }
+    for _, track := range v.moov.Tracks() {
+        tracks = append(tracks, track.Info())
+    }
+    return
+}
+
+// Get the iTunes metadata, for example, the title, artist and cover.
+func (v *Mp4Decoder) Tags() []*Mp4IlstItem {
+    return v.tags
+}
+
+// Find the QuickTime chapter text track, which is referenced by the tref of A/V track.
+func (v *Mp4Decoder) findChapterTrack(moov *Mp4MovieBox) *Mp4TrackBox {
+    for _, track := range moov.Tracks() {
+        for _, trackId := range track.chapterTrackIds() {
+            if chapterTrack, err := moov.Track(trackId); err == nil {
+                return chapterTrack
+            }
+        }
+    }
+    return nil
+}
+
+/**
+ * Detect the keyframes of H.264 by the NALUs in samples, for the stss maybe missing or wrong.
+ * The sample is keyframe when contains IDR slice, or inter frame when contains non-IDR slice.
+ */
+func (v *Mp4Decoder) detectKeyframes(mp4Url string) (err error) {
+    if v.vcodec != SrsVideoCodecIdAVC {
+        ol.W(nil, fmt.Sprintf("ignore detect keyframes for video codec %v", v.vcodec))
+        return
+    }
+
+    var avcc *Mp4AvccBox
+    if avcc, err = v.vide.avcc(); err != nil {
+        return
+    }
+    var naluLengthSize int
+    if naluLengthSize, err = avcc.naluLengthSize(); err != nil {
+        return
+    }
+
+    var f *os.File
+    if f, err = os.Open(mp4Url); err != nil {
+        ol.E(nil, fmt.Sprintf("open mp4 file failed, err is %v", err))
+        return
+    }
+    defer f.Close()
+
+    var nbKeyframes, nbChanged int
+    for _, ms := range v.samples.samples {
+        if ms.sampleType != SrsFrameTypeVideo {
+            continue
+        }
+
+        data := make([]byte, ms.nbData)
+        if _, err = f.ReadAt(data, int64(ms.offset)); err != nil {
+            ol.E(nil, fmt.Sprintf("read video sample at %v failed, err is %v", ms.offset, err))
+            return
+        }
+
+        frameType, ok := avcFrameType(data, naluLengthSize)
+        if !ok {
+            continue
+        }
+        if frameType != ms.frameType {
+            nbChanged++
+        }
+        if frameType == SrsVideoAvcFrameTypeKeyFrame {
+            nbKeyframes++
+        }
+        ms.frameType = frameType
+    }
+
+    ol.T(nil, fmt.Sprintf("detect keyframes ok, keyframes=%v, changed=%v", nbKeyframes, nbChanged))
+    return
+}
+
+// Get the frame type by the NALUs of sample, which is prefixed by length.
+// @return ok is false if no slice in sample, for example, only SEI.
+func avcFrameType(data []byte, naluLengthSize int) (frameType int, ok bool) {
+    for len(data) > naluLengthSize {
+        var size int
+        for i := 0; i < naluLengthSize; i++ {
+            size = size << 8 | int(data[i])
+        }
+        data = data[naluLengthSize:]
+        if size == 0 || size > len(data) {
+            break
+        }
+
+        switch data[0] & 0x1f {
+        case SrsAvcNaluTypeIDR:
+            return SrsVideoAvcFrameTypeKeyFrame, true
+        case SrsAvcNaluTypeNonIDR:
+            frameType, ok = SrsVideoAvcFrameTypeInterFrame, true
+        }
+        data = data[size:]
+    }
+    return
+}
+
+// Whether the track is referenced as chapter by any track.
+func (v *Mp4Decoder) isChapterTrack(moov *Mp4MovieBox, track *Mp4TrackBox) bool {
+    tkhd, err := track.tkhd()
+    if err != nil {
+        return false
+    }
+    for _, t := range moov.Tracks() {
+        for _, trackId := range t.chapterTrackIds() {
+            if trackId == tkhd.TrackId {
+                return true
+            }
+        }
+    }
+    return false
+}
+
+// Get the subtitles sort by timestamp, the text is read from file and decoded by the sample entry.
+func (v *Mp4Decoder) Subtitles(mp4Url string) (subtitles []*Mp4Subtitle, err error) {
+    for _, ts := range v.samples.subtitles {
+        var track *Mp4TrackBox
+        if track, err = v.moov.Track(ts.trackId); err != nil {
+            return
+        }
+
+        var data []byte
+        if data, err = readAt(mp4Url, int64(ts.offset), int(ts.nbData)); err != nil {
+            return
+        }
+
+        subtitle := &Mp4Subtitle{time: ts.dts_ms(), trackId: ts.trackId}
+        if mdhd, err := track.mdhd(); err == nil {
+            subtitle.language = mdhd.language()
+        }
+        if track.text_codec() == SrsMp4BoxTypeWVTT {
+            subtitle.text = webVTTSampleString(data)
+        } else {
+            subtitle.text = textSampleString(data)
+        }
+        subtitles = append(subtitles, subtitle)
+    }
+    return
+}
+
+// Get the chapters, the title of QuickTime chapter is the text sample read from file,
+// and no chapters when the chapter track is broken.
+// The chapters are rebased with A/V, the chapter before the first sample starts from zero.
+func (v *Mp4Decoder) Chapters(mp4Url string) (chapters []*Mp4Chapter, err error) {
+    if v.chpl != nil {
+        for _, entry := range v.chpl.entries {
+            chapters = append(chapters, &Mp4Chapter{time: v.samples.rebase_ms(int64(entry.startTime), 10000000), title: entry.title})
+        }
+        return
+    }
+
+    if v.chapterTrack == nil {
+        return
+    }
+
+    // The chapters are optional, so ignore all chapters when the chapter track is broken.
+    var mvhd *Mp4MovieHeaderBox
+    if mvhd, err = v.moov.Mvhd(); err != nil {
+        ol.W(nil, fmt.Sprintf("ignore chapters, err is %v", err))
+        return nil, nil
+    }
+
+    // Use a standalone manager, for the chapter track never affects the A/V.
+    var tses []*Mp4Sample
+    if tses, err = NewMp4SampleManager().load_trak(SrsFrameTypeScript, v.chapterTrack, mvhd.TimeScale); err != nil {
+        ol.W(nil, fmt.Sprintf("ignore chapters, load chapter track failed, err is %v", err))
+        return nil, nil
+    }
+
+    for _, ts := range tses {
+        var data []byte
+        if data, err = readAt(mp4Url, int64(ts.offset), int(ts.nbData)); err != nil {
+            ol.W(nil, fmt.Sprintf("ignore chapters, read chapter %v failed, err is %v", ts.index, err))
+            return nil, nil
+        }
+        chapters = append(chapters, &Mp4Chapter{time: v.samples.rebase_ms(ts.dts, ts.tbn), title: textSampleString(data)})
+    }
+    return
+}
+
+// Whether there is video track to convert.
+func (v *Mp4Decoder) hasVideo() bool {
+    return v.vide != nil
+}
+
+// Whether there is audio track to convert.
+func (v *Mp4Decoder) hasAudio() bool {
+    return v.soun != nil
+}
+
+func (v *Mp4Decoder) parseMoofs() (err error) {
+    ol.T(nil, fmt.Sprintf("...start to parse %v moofs....", len(v.moofs)))
+    if err = v.samples.load_fragments(v.moov, v.moofs, v.vide, v.soun, v.subtitles); err != nil {
+        return
+    }
+
+    // The duration of fragmented mp4 maybe zero in mvhd, use the samples.
+    if v.duration == 0 {
+        v.duration = v.samples.duration()
+    }
     return
 }
 
@@ -459,6 +1507,32 @@ func (v *Mp4Decoder) parseMoov(moov *Mp4MovieBox) (err error) {
  * @remark The decoder will generate the first two audio/video sequence header.
  */
 func (v *Mp4Decoder) readSample(mp4Url string) (s *SrsMp4Sample, err error) {
+    var ms *Mp4Sample
+    if s, ms, err = v.nextSample(); err != nil {
+        return
+    }
+
+    // The sequence header is generated with payload.
+    if ms == nil {
+        return
+    }
+
+    var data []byte
+    if data, err = readAt(mp4Url, int64(ms.offset), int(ms.nbData)); err != nil {
+        return
+    }
+    if ms.sampleType == SrsFrameTypeAudio && (v.pcmBigEndian || v.pcmSigned) {
+        pcmToFlv(data, v.pcmBigEndian, v.pcmSigned)
+    }
+    s.sample = append(s.sample, data...)
+    return
+}
+
+/**
+ * Get the next sample without reading the payload, the ms is nil for the sequence header.
+ * @remark User can use it to calc the layout of flv, then rewind to read samples.
+ */
+func (v *Mp4Decoder) nextSample() (s *SrsMp4Sample, ms *Mp4Sample, err error) {
     s = NewSrsMp4Smaple()
 
     if !v.avccWritten && (len(v.pavcc) != 0) {
@@ -485,9 +1559,9 @@ func (v *Mp4Decoder) readSample(mp4Url string) (s *SrsMp4Sample, err error) {
 
     v.curIndex ++
     if v.curIndex >= uint32(len(v.samples.samples)) {
-        return nil, fmt.Errorf("sample reach end")
+        return nil, nil, fmt.Errorf("sample reach end")
     }
-    ms := v.samples.samples[v.curIndex]
+    ms = v.samples.samples[v.curIndex]
 
     if ms.sampleType == SrsFrameTypeVideo {
         s.handlerType = SrsMp4HandlerTypeVIDE
@@ -501,12 +1575,13 @@ func (v *Mp4Decoder) readSample(mp4Url string) (s *SrsMp4Sample, err error) {
     s.pts = ms.pts_ms()
     s.frameType = uint16(ms.frameType)
 
-
     s.nbSample = ms.nbData
-    var data []byte
-    if data, err = readAt(mp4Url, int64(ms.offset), int(ms.nbData)); err != nil {
-        return
-    }
-    s.sample = append(s.sample, data...)
     return
+}
+
+// Rewind to the first sample, the sequence headers are generated again.
+func (v *Mp4Decoder) rewind() {
+    v.curIndex = 0
+    v.avccWritten = false
+    v.ascWritten = false
 }
\ No newline at end of file
@@ -0,0 +1,361 @@
+package main
+
+import (
+    "encoding/binary"
+    "math"
+    "reflect"
+    "strings"
+    "testing"
+)
+
+// Build the samples of track, the pts is dts plus the cts, and the keyframes are the indexes of video.
+func makeSamples(sampleType int, tbn uint32, duration uint32, cts []int64, keyframes ...int) (tses []*Mp4Sample) {
+    for i := range cts {
+        ts := NewMp4Sample()
+        ts.sampleType = sampleType
+        ts.index = uint32(i)
+        ts.tbn = tbn
+        ts.dts = int64(i) * int64(duration)
+        ts.pts = ts.dts + cts[i]
+        ts.duration = duration
+        if sampleType == SrsFrameTypeVideo {
+            ts.frameType = SrsVideoAvcFrameTypeInterFrame
+        }
+        tses = append(tses, ts)
+    }
+    for _, k := range keyframes {
+        tses[k].frameType = SrsVideoAvcFrameTypeKeyFrame
+    }
+    return
+}
+
+// Build the trak with elst, each edit is the segment duration, media time and media rate integer.
+func makeElstTrack(t *testing.T, edits ...[3]int32) *Mp4TrackBox {
+    var entries []byte
+    for _, edit := range edits {
+        entry := make([]byte, 12)
+        binary.BigEndian.PutUint32(entry, uint32(edit[0]))
+        binary.BigEndian.PutUint32(entry[4:], uint32(edit[1]))
+        binary.BigEndian.PutUint16(entry[8:], uint16(edit[2]))
+        entries = append(entries, entry...)
+    }
+    count := make([]byte, 4)
+    binary.BigEndian.PutUint32(count, uint32(len(edits)))
+
+    elst := makeFullBox("elst", 0, 0, count, entries)
+    box, err := decodeBox(makeBox("trak", false, makeBox("edts", false, elst)), false)
+    if err != nil {
+        t.Fatalf("decode trak failed, err is %v", err)
+    }
+    return box.(*Mp4TrackBox)
+}
+
+func TestMp4SampleManager_apply_edits(t *testing.T) {
+    for _, c := range []struct {
+        name string
+        track *Mp4TrackBox
+        movieTimeScale uint32
+        samples []*Mp4Sample
+        dts []int64
+        pts []int64
+    }{
+        {
+            "no edits", &Mp4TrackBox{}, 1000,
+            makeSamples(SrsFrameTypeAudio, 1000, 20, []int64{0, 0, 0}),
+            []int64{0, 20, 40}, []int64{0, 20, 40},
+        }, {
+            // The empty edit inserts the initial delay, in the movie timescale.
+            "empty edit", makeElstTrack(t, [3]int32{300, -1, 1}, [3]int32{1000, 0, 1}), 600,
+            makeSamples(SrsFrameTypeAudio, 90000, 3000, []int64{0, 0}),
+            []int64{45000, 48000}, []int64{45000, 48000},
+        }, {
+            // The AAC priming samples before the media time are dropped.
+            "audio media time", makeElstTrack(t, [3]int32{1000, 2048, 1}), 1000,
+            makeSamples(SrsFrameTypeAudio, 44100, 1024, []int64{0, 0, 0, 0}),
+            []int64{0, 1024}, []int64{0, 1024},
+        }, {
+            // The B-frames shift the dts to negative, but never drop the samples.
+            "video cts", makeElstTrack(t, [3]int32{1000, 80, 1}), 1000,
+            makeSamples(SrsFrameTypeVideo, 1000, 40, []int64{80, 120, 40, 80}, 0),
+            []int64{-80, -40, 0, 40}, []int64{0, 80, 40, 120},
+        }, {
+            // The last keyframe before the media time is required to decode.
+            "video keyframe", makeElstTrack(t, [3]int32{1000, 100, 1}), 1000,
+            makeSamples(SrsFrameTypeVideo, 1000, 40, []int64{0, 0, 0, 0, 0}, 0, 2),
+            []int64{-20, 20, 60}, []int64{-20, 20, 60},
+        }, {
+            // Only the first media edit is applied, whatever the rate.
+            "multiple edits", makeElstTrack(t, [3]int32{500, -1, 1}, [3]int32{1000, 20, 1}, [3]int32{1000, 0, 0}), 1000,
+            makeSamples(SrsFrameTypeAudio, 1000, 20, []int64{0, 0, 0}),
+            []int64{500, 520}, []int64{500, 520},
+        },
+    } {
+        v := NewMp4SampleManager()
+        tses := v.apply_edits(c.track, c.samples, c.movieTimeScale)
+
+        var dts, pts []int64
+        for _, ts := range tses {
+            dts, pts = append(dts, ts.dts), append(pts, ts.pts)
+        }
+        if !reflect.DeepEqual(dts, c.dts) || !reflect.DeepEqual(pts, c.pts) {
+            t.Errorf("%v, dts=%v, pts=%v, expect dts=%v, pts=%v", c.name, dts, pts, c.dts, c.pts)
+        }
+        if expect := len(c.track.Boxes) > 0; v.hasEdits != expect {
+            t.Errorf("%v, has edits is %v, expect %v", c.name, v.hasEdits, expect)
+        }
+    }
+
+    // The edits of subtitle never affect the A/V sync.
+    v := NewMp4SampleManager()
+    tses := v.apply_edits(makeElstTrack(t, [3]int32{500, -1, 1}, [3]int32{1000, 0, 1}), makeSamples(SrsFrameTypeScript, 1000, 1000, []int64{0}), 1000)
+    if v.hasEdits || tses[0].dts != 500 {
+        t.Errorf("subtitle, has edits is %v, dts is %v", v.hasEdits, tses[0].dts)
+    }
+}
+
+func TestAvcFrameType(t *testing.T) {
+    for _, c := range []struct {
+        name string
+        data []byte
+        naluLengthSize int
+        frameType int
+        ok bool
+    }{
+        {"IDR", []byte{0, 0, 0, 2, 0x65, 0x88}, 4, SrsVideoAvcFrameTypeKeyFrame, true},
+        {"non-IDR", []byte{0, 0, 0, 2, 0x41, 0x9a}, 4, SrsVideoAvcFrameTypeInterFrame, true},
+        // The SEI and AUD before the slice.
+        {"SEI and IDR", []byte{0, 0, 0, 2, 0x06, 0x05, 0, 0, 0, 1, 0x09, 0, 0, 0, 2, 0x25, 0x88}, 4, SrsVideoAvcFrameTypeKeyFrame, true},
+        {"SPS and PPS and IDR", []byte{0, 2, 0x67, 0x42, 0, 1, 0x68, 0, 2, 0x65, 0x88}, 2, SrsVideoAvcFrameTypeKeyFrame, true},
+        {"non-IDR of 1 byte length", []byte{2, 0x01, 0x9a}, 1, SrsVideoAvcFrameTypeInterFrame, true},
+        // The IDR after the non-IDR slice is keyframe.
+        {"non-IDR and IDR", []byte{0, 0, 0, 1, 0x41, 0, 0, 0, 1, 0x65}, 4, SrsVideoAvcFrameTypeKeyFrame, true},
+        // Without slice, or the broken NALUs.
+        {"SEI only", []byte{0, 0, 0, 2, 0x06, 0x05}, 4, 0, false},
+        {"empty", []byte{}, 4, 0, false},
+        {"zero size", []byte{0, 0, 0, 0, 0x65}, 4, 0, false},
+        {"overflow", []byte{0, 0, 0, 9, 0x65, 0x88}, 4, 0, false},
+    } {
+        if frameType, ok := avcFrameType(c.data, c.naluLengthSize); frameType != c.frameType || ok != c.ok {
+            t.Errorf("%v, frame type is %v, ok is %v, expect %v, %v", c.name, frameType, ok, c.frameType, c.ok)
+        }
+    }
+}
+
+// Build the traf of track, the samples are the default duration from the tfdt in version 1.
+func makeTraf(t *testing.T, trackId uint32, tfdt uint64, duration uint32, count uint32) (*Mp4TrackFragmentBox, *Mp4TrackFragmentHeaderBox) {
+    tfhd := make([]byte, 12)
+    binary.BigEndian.PutUint32(tfhd, trackId)
+    binary.BigEndian.PutUint32(tfhd[4:], duration)
+    binary.BigEndian.PutUint32(tfhd[8:], 1)
+    tfdtData := make([]byte, 8)
+    binary.BigEndian.PutUint64(tfdtData, tfdt)
+    trun := make([]byte, 4)
+    binary.BigEndian.PutUint32(trun, count)
+
+    box, err := decodeBox(makeBox("traf", false,
+        makeFullBox("tfhd", 0, SrsMp4TfhdFlagsDefaultSampleDuration | SrsMp4TfhdFlagsDefaultSampleSize | SrsMp4TfhdFlagsDefaultBaseIsMoof, tfhd),
+        makeFullBox("tfdt", 1, 0, tfdtData),
+        makeFullBox("trun", 0, 0, trun)), false)
+    if err != nil {
+        t.Fatalf("decode traf failed, err is %v", err)
+    }
+
+    traf := box.(*Mp4TrackFragmentBox)
+    header, err := traf.tfhd()
+    if err != nil {
+        t.Fatalf("no tfhd, err is %v", err)
+    }
+    return traf, header
+}
+
+func TestMp4SampleManager_buildFragmentsTfdt(t *testing.T) {
+    // The epoch based tfdt, about 54 years, the audio starts 10ms after video.
+    const epoch = 1700000000
+    for _, c := range []struct {
+        name string
+        vtfdt, atfdt uint64
+    }{
+        {"CMAF tfdt", 10 * 90000, 10 * 48000 + 480},
+        {"epoch tfdt", epoch * 90000, epoch * 48000 + 480},
+    } {
+        video := &Mp4FragmentTrack{frameType: SrsFrameTypeVideo, trackId: 1, tbn: 90000}
+        traf, tfhd := makeTraf(t, 1, c.vtfdt, 3000, 3)
+        if _, err := video.load_traf(traf, tfhd, 0, 0); err != nil {
+            t.Fatalf("%v, load video traf failed, err is %v", c.name, err)
+        }
+
+        audio := &Mp4FragmentTrack{frameType: SrsFrameTypeAudio, trackId: 2, tbn: 48000}
+        traf, tfhd = makeTraf(t, 2, c.atfdt, 1024, 2)
+        if _, err := audio.load_traf(traf, tfhd, 0, 0); err != nil {
+            t.Fatalf("%v, load audio traf failed, err is %v", c.name, err)
+        }
+
+        // The A/V sync by the edit list, never adjust it.
+        v := NewMp4SampleManager()
+        v.hasEdits = true
+        if err := v.build(append(video.samples, audio.samples...)); err != nil {
+            t.Fatalf("%v, build failed, err is %v", c.name, err)
+        }
+
+        var vdts, adts []uint32
+        for _, ts := range v.samples {
+            if ts.sampleType == SrsFrameTypeVideo {
+                vdts = append(vdts, ts.dts_ms())
+            } else {
+                adts = append(adts, ts.dts_ms())
+            }
+        }
+        if expect := []uint32{0, 33, 66}; !reflect.DeepEqual(vdts, expect) {
+            t.Errorf("%v, video dts is %v, expect %v", c.name, vdts, expect)
+        }
+        if expect := []uint32{10, 31}; !reflect.DeepEqual(adts, expect) {
+            t.Errorf("%v, audio dts is %v, expect %v", c.name, adts, expect)
+        }
+
+        // The duration is from the first video to the end of last video, 3 frames of 33.3ms.
+        if d := v.duration(); d < 99 || d > 101 {
+            t.Errorf("%v, duration is %v, expect 100", c.name, d)
+        }
+
+        // The chapter and subtitle are rebased with A/V, in the timebase of their own.
+        if ms := v.rebase_ms(int64(c.vtfdt / 90000) * 10000000 + 5000000, 10000000); ms != 500 {
+            t.Errorf("%v, chapter at 500ms is %v", c.name, ms)
+        }
+        if ms := v.rebase_ms(0, 1000); ms != 0 {
+            t.Errorf("%v, chapter before A/V is %v, expect 0", c.name, ms)
+        }
+    }
+}
+
+func TestMp4Decoder_parseFtyp(t *testing.T) {
+    for _, c := range []struct {
+        major uint32
+        compatibles []uint32
+        ok bool
+    }{
+        {SrsMp4BoxBrandISOM, nil, true},
+        {SrsMp4BoxBrandM4A, nil, true},
+        {SrsMp4BoxBrandQT, nil, true},
+        // The unknown major brand with legal compatible brand.
+        {0x61626364, []uint32{0x65666768, SrsMp4BoxBrandISO2}, true},
+        {0x61626364, []uint32{0x65666768, 0x696a6b6c}, false},
+    } {
+        err := NewMp4Decoder().parseFtyp(&Mp4FileTypeBox{majorBrand: c.major, compatibleBrands: c.compatibles})
+        if (err == nil) != c.ok {
+            t.Errorf("brand %v, compatible %v, err is %v", fourCCString(c.major), c.compatibles, err)
+        }
+    }
+
+    // The error shows the brands, to know why the file is rejected.
+    err := NewMp4Decoder().parseFtyp(&Mp4FileTypeBox{majorBrand: 0x61626364, compatibleBrands: []uint32{0x65666768, 0x696a6b6c}})
+    if err == nil || !strings.Contains(err.Error(), "brand=abcd, compatible=[efgh,ijkl]") {
+        t.Errorf("error is %v", err)
+    }
+}
+
+func TestMp4Decoder_ChaptersBroken(t *testing.T) {
+    box, err := decodeBox(makeBox("moov", false, makeFullBox("mvhd", 0, 0, make([]byte, 96))), true)
+    if err != nil {
+        t.Fatalf("decode moov failed, err is %v", err)
+    }
+
+    // The chapter track without mdhd and stbl, the chapters are ignored.
+    v := NewMp4Decoder()
+    v.moov = box.(*Mp4MovieBox)
+    v.chapterTrack = &Mp4TrackBox{}
+    if chapters, err := v.Chapters("not-exists.mp4"); err != nil || len(chapters) != 0 {
+        t.Errorf("chapters is %v, err is %v", chapters, err)
+    }
+}
+
+// Build the trak with one audio sample entry, the rate and flags are in sound description version 2.
+func makeAudioTrack(t *testing.T, bt string, version uint16, channels, bits uint16, rate float64, flags uint32, boxes ...[]byte) *Mp4TrackBox {
+    entry := make([]byte, 28)
+    binary.BigEndian.PutUint16(entry[6:], 1)
+    binary.BigEndian.PutUint16(entry[8:], version)
+    binary.BigEndian.PutUint16(entry[16:], channels)
+    binary.BigEndian.PutUint16(entry[18:], bits)
+    binary.BigEndian.PutUint32(entry[24:], uint32(rate) << 16)
+    if version == 2 {
+        v2 := make([]byte, 36)
+        binary.BigEndian.PutUint32(v2, 72)
+        binary.BigEndian.PutUint64(v2[4:], math.Float64bits(rate))
+        binary.BigEndian.PutUint32(v2[12:], uint32(channels))
+        binary.BigEndian.PutUint32(v2[16:], 0x7f000000)
+        binary.BigEndian.PutUint32(v2[20:], uint32(bits))
+        binary.BigEndian.PutUint32(v2[24:], flags)
+        // The placeholders of version 2, the 3 channels, 16 bits at 65536Hz.
+        binary.BigEndian.PutUint16(entry[16:], 3)
+        binary.BigEndian.PutUint16(entry[18:], 16)
+        binary.BigEndian.PutUint32(entry[24:], 0x00010000)
+        entry = append(entry, v2...)
+    }
+
+    stsd := makeFullBox("stsd", 0, 0, []byte{0, 0, 0, 1}, makeBox(bt, false, append([][]byte{entry}, boxes...)...))
+    stbl := makeBox("stbl", false, stsd)
+    box, err := decodeBox(makeBox("trak", false, makeBox("mdia", false, makeBox("minf", false, stbl))), false)
+    if err != nil {
+        t.Fatalf("decode %v trak failed, err is %v", bt, err)
+    }
+    return box.(*Mp4TrackBox)
+}
+
+func TestMp4Decoder_parsePcm(t *testing.T) {
+    const float, bigEndian, signed = SrsMp4LpcmFlagIsFloat, SrsMp4LpcmFlagIsBigEndian, SrsMp4LpcmFlagIsSignedInteger
+    for _, c := range []struct {
+        name string
+        track *Mp4TrackBox
+        soundBits int
+        bigEndian, signed bool
+    }{
+        {"sowt", makeAudioTrack(t, "sowt", 0, 2, 16, 44100, 0), SrsAudioSampleBits16bit, false, false},
+        {"twos", makeAudioTrack(t, "twos", 0, 2, 16, 44100, 0), SrsAudioSampleBits16bit, true, false},
+        // The 8 bits sowt and twos are signed, the byte order is only for 16 bits.
+        {"sowt 8 bits", makeAudioTrack(t, "sowt", 0, 1, 8, 22050, 0), SrsAudioSampleBits8bit, false, true},
+        {"twos 8 bits", makeAudioTrack(t, "twos", 0, 1, 8, 11025, 0), SrsAudioSampleBits8bit, false, true},
+        {"lpcm le", makeAudioTrack(t, "lpcm", 2, 2, 16, 44100, signed), SrsAudioSampleBits16bit, false, false},
+        {"lpcm be", makeAudioTrack(t, "lpcm", 2, 2, 16, 44100, bigEndian | signed), SrsAudioSampleBits16bit, true, false},
+        {"lpcm 8 bits unsigned", makeAudioTrack(t, "lpcm", 2, 1, 8, 5512, 0), SrsAudioSampleBits8bit, false, false},
+        {"lpcm 8 bits signed", makeAudioTrack(t, "lpcm", 2, 1, 8, 5512, bigEndian | signed), SrsAudioSampleBits8bit, false, true},
+        {"ipcm be", makeAudioTrack(t, "ipcm", 0, 2, 16, 44100, 0, makeFullBox("pcmC", 0, 0, []byte{0, 16})), SrsAudioSampleBits16bit, true, false},
+        {"ipcm le", makeAudioTrack(t, "ipcm", 0, 2, 16, 44100, 0, makeFullBox("pcmC", 0, 0, []byte{1, 16})), SrsAudioSampleBits16bit, false, false},
+    } {
+        v := NewMp4Decoder()
+        if err := v.parseAudio(c.track); err != nil {
+            t.Errorf("%v, parse failed, err is %v", c.name, err)
+            continue
+        }
+        if v.acodec != SrsAudioCodecIdLinearPCMLittleEndian || v.soundBits != c.soundBits {
+            t.Errorf("%v, codec is %v, sound bits is %v, expect %v", c.name, v.acodec, v.soundBits, c.soundBits)
+        }
+        if v.pcmBigEndian != c.bigEndian || v.pcmSigned != c.signed {
+            t.Errorf("%v, big endian is %v, signed is %v, expect %v, %v", c.name, v.pcmBigEndian, v.pcmSigned, c.bigEndian, c.signed)
+        }
+    }
+
+    for _, c := range []struct {
+        name string
+        track *Mp4TrackBox
+    }{
+        // The FLV PCM only plays at 5512, 11025, 22050 or 44100Hz.
+        {"sowt 48k", makeAudioTrack(t, "sowt", 0, 2, 16, 48000, 0)},
+        {"lpcm 8k", makeAudioTrack(t, "lpcm", 2, 1, 16, 8000, signed)},
+        {"sowt 24 bits", makeAudioTrack(t, "sowt", 0, 2, 24, 44100, 0)},
+        {"sowt 6 channels", makeAudioTrack(t, "sowt", 0, 6, 16, 44100, 0)},
+        {"lpcm float", makeAudioTrack(t, "lpcm", 2, 2, 32, 44100, float)},
+        {"lpcm version 0", makeAudioTrack(t, "lpcm", 0, 2, 16, 44100, 0)},
+        {"ipcm without pcmC", makeAudioTrack(t, "ipcm", 0, 2, 16, 44100, 0)},
+        // The G.711 is only 8kHz in FLV.
+        {"ulaw 16k", makeAudioTrack(t, "ulaw", 0, 1, 16, 16000, 0)},
+        {"alaw 44.1k", makeAudioTrack(t, "alaw", 0, 1, 16, 44100, 0)},
+    } {
+        if err := NewMp4Decoder().parseAudio(c.track); err == nil {
+            t.Errorf("%v, should fail", c.name)
+        }
+    }
+
+    v := NewMp4Decoder()
+    if err := v.parseAudio(makeAudioTrack(t, "alaw", 0, 1, 16, 8000, 0)); err != nil || v.acodec != SrsAudioCodecIdReservedG711AlawLogarithmicPCM {
+        t.Errorf("alaw 8k, codec is %v, err is %v", v.acodec, err)
+    }
+}
@@ -2,6 +2,8 @@ package main
 
 import (
     "encoding/binary"
+    "strings"
+    "unicode/utf16"
     "os"
     "fmt"
     ol "github.com/ossrs/go-oryx-lib/logger"
@@ -43,6 +45,11 @@ func Uint32To3Bytes(data uint32) (res []byte) {
     return res
 }
 
+// Convert the FourCC, for example, 0x61766331 to 'avc1'.
+func fourCCString(v uint32) string {
+    return string([]byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)})
+}
+
 func max(x, y int32) int32 {
     if x > y {
         return x
@@ -79,8 +86,78 @@ func readAt(mp4 string, offset int64, length int) (data []byte, err error) {
     return
 }
 
-//TODO: need complete
-func to3Bytes(from uint32) (to []byte) {
+// Convert the signed 24bits integer to 3 bytes in big-endian, the negative is two's complement.
+// For example, the CompositionTime of video tag.
+func to3Bytes(from int32) (to []byte) {
     to = make([]byte, 3)
+    to[0] = byte(from >> 16)
+    to[1] = byte(from >> 8)
+    to[2] = byte(from)
     return
-}
\ No newline at end of file
+}
+
+// Get the text of sample, for QuickTime text and 3GPP timed text(tx3g), which is 16 bits length
+// and the text in UTF-8, or UTF-16 with BOM, the modifier boxes after the text are ignored.
+func textSampleString(data []byte) string {
+    if len(data) < 2 {
+        return ""
+    }
+    size := int(binary.BigEndian.Uint16(data))
+    if size > len(data) - 2 {
+        size = len(data) - 2
+    }
+    text := data[2:2 + size]
+
+    if len(text) >= 2 && text[0] == 0xfe && text[1] == 0xff {
+        u16s := make([]uint16, (len(text) - 2) / 2)
+        for i := range u16s {
+            u16s[i] = binary.BigEndian.Uint16(text[2 + 2 * i:])
+        }
+        return string(utf16.Decode(u16s))
+    }
+    return string(text)
+}
+
+// Get the text of WebVTT sample, the payl of each vttc cue, joined by new line.
+// The vtte means no cue, so the text is empty.
+func webVTTSampleString(data []byte) string {
+    var texts []string
+    for len(data) >= 8 {
+        size, bt := int(binary.BigEndian.Uint32(data)), binary.BigEndian.Uint32(data[4:])
+        if size < 8 || size > len(data) {
+            break
+        }
+
+        // The payl is in the vttc.
+        if bt == SrsMp4BoxTypeVTTCUE {
+            cue := data[8:size]
+            for len(cue) >= 8 {
+                csize, cbt := int(binary.BigEndian.Uint32(cue)), binary.BigEndian.Uint32(cue[4:])
+                if csize < 8 || csize > len(cue) {
+                    break
+                }
+                if cbt == SrsMp4BoxTypePAYL {
+                    texts = append(texts, string(cue[8:csize]))
+                }
+                cue = cue[csize:]
+            }
+        }
+        data = data[size:]
+    }
+    return strings.Join(texts, "\n")
+}
+
+// Convert the PCM samples in place for FLV, swap the 16 bits big-endian to little-endian,
+// or convert the 8 bits signed to unsigned.
+func pcmToFlv(data []byte, bigEndian, signed bool) {
+    if bigEndian {
+        for i := 0; i + 1 < len(data); i += 2 {
+            data[i], data[i + 1] = data[i + 1], data[i]
+        }
+    }
+    if signed {
+        for i := range data {
+            data[i] ^= 0x80
+        }
+    }
+}
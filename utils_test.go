@@ -0,0 +1,48 @@
+package main
+
+import (
+    "bytes"
+    "testing"
+)
+
+func TestTo3Bytes(t *testing.T) {
+    for _, c := range []struct {
+        from int32
+        expect []byte
+    }{
+        {0, []byte{0, 0, 0}},
+        {80, []byte{0, 0, 0x50}},
+        {0x7fffff, []byte{0x7f, 0xff, 0xff}},
+        // The negative composition time offset is in two's complement of 24 bits.
+        {-1, []byte{0xff, 0xff, 0xff}},
+        {-40, []byte{0xff, 0xff, 0xd8}},
+        {-0x800000, []byte{0x80, 0, 0}},
+    } {
+        if to := to3Bytes(c.from); !bytes.Equal(to, c.expect) {
+            t.Errorf("from %v, got %x, expect %x", c.from, to, c.expect)
+        }
+    }
+}
+
+func TestPcmToFlv(t *testing.T) {
+    for _, c := range []struct {
+        name string
+        bigEndian, signed bool
+        data, expect []byte
+    }{
+        // The sowt and little-endian lpcm is the FLV PCM, the 16 bits is always signed.
+        {"sowt", false, false, []byte{0x01, 0x02, 0xff, 0x7f}, []byte{0x01, 0x02, 0xff, 0x7f}},
+        {"twos", true, false, []byte{0x01, 0x02, 0x7f, 0xff}, []byte{0x02, 0x01, 0xff, 0x7f}},
+        // The 8 bits signed to unsigned, the -128, -1, 0 and 127.
+        {"8 bits signed", false, true, []byte{0x80, 0xff, 0x00, 0x7f}, []byte{0x00, 0x7f, 0x80, 0xff}},
+        {"8 bits unsigned", false, false, []byte{0x00, 0x7f, 0x80, 0xff}, []byte{0x00, 0x7f, 0x80, 0xff}},
+        // The truncated last byte of 16 bits is kept.
+        {"twos odd", true, false, []byte{0x01, 0x02, 0x03}, []byte{0x02, 0x01, 0x03}},
+        {"empty", true, true, []byte{}, []byte{}},
+    } {
+        data := append([]byte{}, c.data...)
+        if pcmToFlv(data, c.bigEndian, c.signed); !bytes.Equal(data, c.expect) {
+            t.Errorf("%v, got %x, expect %x", c.name, data, c.expect)
+        }
+    }
+}